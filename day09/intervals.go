@@ -0,0 +1,88 @@
+package main
+
+import (
+	"sort"
+)
+
+type Interval struct {
+	Lo, Hi int
+}
+
+type IntervalSet struct {
+	intervals []Interval
+	length    int
+}
+
+func (iv Interval) Len() int {
+	return iv.Hi - iv.Lo
+}
+
+func (set *IntervalSet) Len() int {
+	return set.length
+}
+
+func (set *IntervalSet) search(val int) int {
+	return sort.Search(len(set.intervals), func(i int) bool {
+		return set.intervals[i].Hi > val
+	})
+}
+
+func (set *IntervalSet) Contains(val int) bool {
+	i := set.search(val)
+	return i < len(set.intervals) && set.intervals[i].Lo <= val
+}
+
+func (set *IntervalSet) Uncovered(lo, hi int) (result []Interval) {
+	for i := set.search(lo); i < len(set.intervals) && lo < hi; i++ {
+		iv := set.intervals[i]
+		if iv.Lo >= hi {
+			break
+		}
+		if iv.Lo > lo {
+			result = append(result, Interval{lo, iv.Lo})
+		}
+		lo = iv.Hi
+	}
+	if lo < hi {
+		result = append(result, Interval{lo, hi})
+	}
+	return
+}
+
+func (set *IntervalSet) Insert(lo, hi int) (added int) {
+	if lo >= hi {
+		return 0
+	}
+
+	first := sort.Search(len(set.intervals), func(i int) bool {
+		return set.intervals[i].Hi >= lo
+	})
+	last := first
+	merged := Interval{lo, hi}
+	covered := 0
+	for ; last < len(set.intervals) && set.intervals[last].Lo <= hi; last++ {
+		iv := set.intervals[last]
+		covered += iv.Len()
+		merged.Lo = Min(merged.Lo, iv.Lo)
+		merged.Hi = Max(merged.Hi, iv.Hi)
+	}
+
+	added = merged.Len() - covered
+	set.length += added
+
+	if first == last {
+		set.intervals = append(set.intervals, Interval{})
+		copy(set.intervals[first+1:], set.intervals[first:])
+		set.intervals[first] = merged
+		return
+	}
+	set.intervals[first] = merged
+	set.intervals = append(set.intervals[:first+1], set.intervals[last:]...)
+	return
+}
+
+func (set *IntervalSet) Traverse(cb func(Interval)) {
+	for _, iv := range set.intervals {
+		cb(iv)
+	}
+}
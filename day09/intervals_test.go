@@ -0,0 +1,85 @@
+package main
+
+import (
+	"testing"
+)
+
+func AssertIntervals(t *testing.T, set *IntervalSet, expected []Interval) {
+	got := []Interval{}
+	set.Traverse(func(iv Interval) {
+		got = append(got, iv)
+	})
+	if len(got) != len(expected) {
+		t.Fatalf("AssertIntervals(t, %v, %v): got %v", set, expected, got)
+	}
+	length := 0
+	for i := range got {
+		if got[i] != expected[i] {
+			t.Fatalf("AssertIntervals(t, %v, %v): got %v", set, expected, got)
+		}
+		length += got[i].Len()
+	}
+	if set.Len() != length {
+		t.Fatalf("AssertIntervals(t, %v, %v): length %d instead of %d", set, expected, set.Len(), length)
+	}
+}
+
+func AssertInsert(t *testing.T, set *IntervalSet, lo, hi, expected int) {
+	added := set.Insert(lo, hi)
+	if added != expected {
+		t.Fatalf("AssertInsert(t, %v, %d, %d, %d): added %d", set, lo, hi, expected, added)
+	}
+}
+
+func TestInsert(t *testing.T) {
+	set := IntervalSet{}
+	AssertInsert(t, &set, 10, 20, 10)
+	AssertInsert(t, &set, 30, 40, 10)
+	AssertInsert(t, &set, 0, 5, 5)
+	AssertIntervals(t, &set, []Interval{{0, 5}, {10, 20}, {30, 40}})
+
+	AssertInsert(t, &set, 12, 18, 0)
+	AssertInsert(t, &set, 5, 10, 5)
+	AssertIntervals(t, &set, []Interval{{0, 20}, {30, 40}})
+
+	AssertInsert(t, &set, -5, 50, 25)
+	AssertIntervals(t, &set, []Interval{{-5, 50}})
+
+	AssertInsert(t, &set, 50, 51, 1)
+	AssertInsert(t, &set, 60, 60, 0)
+	AssertIntervals(t, &set, []Interval{{-5, 51}})
+}
+
+func TestContains(t *testing.T) {
+	set := IntervalSet{}
+	set.Insert(0, 3)
+	set.Insert(5, 6)
+
+	for val, expected := range map[int]bool{-1: false, 0: true, 2: true, 3: false, 4: false, 5: true, 6: false} {
+		if set.Contains(val) != expected {
+			t.Fatalf("Contains(%d) must be %v: %v", val, expected, set)
+		}
+	}
+}
+
+func TestUncovered(t *testing.T) {
+	set := IntervalSet{}
+	set.Insert(0, 3)
+	set.Insert(5, 6)
+	set.Insert(10, 20)
+
+	got := set.Uncovered(-2, 12)
+	expected := []Interval{{-2, 0}, {3, 5}, {6, 10}}
+	if len(got) != len(expected) {
+		t.Fatalf("Uncovered(-2, 12): got %v", got)
+	}
+	for i := range got {
+		if got[i] != expected[i] {
+			t.Fatalf("Uncovered(-2, 12): got %v", got)
+		}
+	}
+
+	if len(set.Uncovered(11, 15)) != 0 {
+		t.Fatalf("Uncovered(11, 15) must be empty")
+	}
+}
@@ -3,65 +3,124 @@ package main
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 )
 
-type Direction int
+// MaxDims is the number of axes a position has. Pos is a fixed-size array so
+// that it can be used as a map key; motions along axes A8 and above are
+// rejected.
+const MaxDims = 8
 
 const (
-	DirUp Direction = iota
-	DirDown
-	DirLeft
-	DirRight
+	AxisX = iota
+	AxisY
+	AxisZ
+	AxisW
 )
 
-const DirCount = 4
+const AxisNames = "XYZW"
+
+type Pos [MaxDims]int
+
+type Direction struct {
+	name  string
+	delta Pos
+}
 
 type Motion struct {
 	Dir   Direction
 	Steps int
 }
 
-type Pos struct {
-	X, Y int
-}
-
 type Rope struct {
 	knots []Pos
 }
 
+type LineFamily struct {
+	dir   Pos
+	axis  int
+	lines map[Pos]*IntervalSet
+}
+
 type PositionMap struct {
-	visited map[Pos]bool
+	families  map[Pos]*LineFamily
+	order     []*LineFamily
+	lineCount int
+	visited   int
+	marks     int
+	min, max  Pos
 }
 
-func (dir Direction) String() string {
-	switch dir {
-	case DirUp:
-		return "U"
-	case DirDown:
-		return "D"
-	case DirLeft:
-		return "L"
-	case DirRight:
-		return "R"
+type KnotTracker struct {
+	maps []PositionMap
+}
+
+func MakeDirection(name string, delta Pos) Direction {
+	return Direction{name, delta}
+}
+
+func AxisDirection(axis, sign int) Direction {
+	if axis < 0 || axis >= MaxDims {
+		panic("Invalid axis")
 	}
-	panic("Invalid direction")
+	name := "+"
+	if sign < 0 {
+		name = "-"
+	}
+	if axis < len(AxisNames) {
+		name += AxisNames[axis : axis+1]
+	} else {
+		name += fmt.Sprintf("A%d", axis)
+	}
+	var delta Pos
+	delta[axis] = sign
+	return MakeDirection(name, delta)
+}
+
+var (
+	DirUp    = MakeDirection("U", Pos{AxisY: 1})
+	DirDown  = MakeDirection("D", Pos{AxisY: -1})
+	DirLeft  = MakeDirection("L", Pos{AxisX: -1})
+	DirRight = MakeDirection("R", Pos{AxisX: 1})
+
+	DirUpLeft    = MakeDirection("UL", Pos{AxisX: -1, AxisY: 1})
+	DirUpRight   = MakeDirection("UR", Pos{AxisX: 1, AxisY: 1})
+	DirDownLeft  = MakeDirection("DL", Pos{AxisX: -1, AxisY: -1})
+	DirDownRight = MakeDirection("DR", Pos{AxisX: 1, AxisY: -1})
+)
+
+func (dir Direction) String() string {
+	return dir.name
+}
+
+func (dir Direction) Delta() Pos {
+	return dir.delta
 }
 
-func (dir Direction) DxDy() (int, int) {
-	switch dir {
-	case DirUp:
-		return 0, 1
-	case DirDown:
-		return 0, -1
-	case DirLeft:
-		return -1, 0
-	case DirRight:
-		return 1, 0
+func (dir Direction) Dims() int {
+	return dir.delta.Dims()
+}
+
+func ParseAxis(s string) int {
+	if len(s) == 1 {
+		axis := strings.Index(AxisNames, s)
+		if axis >= 0 {
+			return axis
+		}
+	} else if strings.HasPrefix(s, "A") {
+		axis, err := strconv.Atoi(s[1:])
+		if err == nil && axis >= MaxDims {
+			panic(fmt.Sprintf("Axis %s is out of range, at most %d dimensions are supported", s, MaxDims))
+		}
+		if err == nil && axis >= 0 {
+			return axis
+		}
 	}
-	panic("Invalid direction")
+	panic("Failed to parse axis")
 }
 
 func ParseDirection(s string) Direction {
@@ -74,9 +133,25 @@ func ParseDirection(s string) Direction {
 		return DirLeft
 	case "R":
 		return DirRight
-	default:
-		panic("Failed to parse direction")
+	case "UL":
+		return DirUpLeft
+	case "UR":
+		return DirUpRight
+	case "DL":
+		return DirDownLeft
+	case "DR":
+		return DirDownRight
 	}
+
+	if len(s) >= 2 {
+		switch s[0] {
+		case '+':
+			return AxisDirection(ParseAxis(s[1:]), 1)
+		case '-':
+			return AxisDirection(ParseAxis(s[1:]), -1)
+		}
+	}
+	panic("Failed to parse direction")
 }
 
 func ParseMotion(s string) (result Motion) {
@@ -102,14 +177,59 @@ func Abs(val int) int {
 	}
 }
 
+func Min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func Max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func (pos Pos) Dims() int {
+	for i := MaxDims - 1; i >= 0; i-- {
+		if pos[i] != 0 {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+func (pos Pos) Format(dims int) string {
+	coords := make([]string, dims)
+	for i := range coords {
+		coords[i] = strconv.Itoa(pos[i])
+	}
+	return strings.Join(coords, ",")
+}
+
 func Adjacent(lhs, rhs Pos) bool {
-	return Abs(lhs.X-rhs.X) <= 1 && Abs(lhs.Y-rhs.Y) <= 1
+	for i := range lhs {
+		if Abs(lhs[i]-rhs[i]) > 1 {
+			return false
+		}
+	}
+	return true
 }
 
 func (pos *Pos) ApplyDirection(direction Direction) {
-	dx, dy := direction.DxDy()
-	pos.X += dx
-	pos.Y += dy
+	pos.Add(direction.delta, 1)
+}
+
+func (pos *Pos) Add(delta Pos, times int) {
+	for i, d := range delta {
+		pos[i] += d * times
+	}
+}
+
+func (pos Pos) Plus(delta Pos, times int) Pos {
+	pos.Add(delta, times)
+	return pos
 }
 
 func MoveCoordTowards(coord *int, target int) {
@@ -121,20 +241,34 @@ func MoveCoordTowards(coord *int, target int) {
 }
 
 func (pos *Pos) MoveTowards(target Pos) {
-	MoveCoordTowards(&pos.X, target.X)
-	MoveCoordTowards(&pos.Y, target.Y)
+	for i := range pos {
+		MoveCoordTowards(&pos[i], target[i])
+	}
 }
 
-func (rope *Rope) ApplyDirection(dir Direction) {
+func (rope *Rope) ApplyDirection(dir Direction) (moved int, rigid bool) {
 	rope.Head().ApplyDirection(dir)
 	prev := *rope.Head()
+	rigid = true
 
-	for i := 1; i < len(rope.knots); i++ {
-		if Adjacent(prev, rope.knots[i]) {
+	for moved = 1; moved < len(rope.knots); moved++ {
+		if Adjacent(prev, rope.knots[moved]) {
+			rigid = false
 			return
 		}
-		rope.knots[i].MoveTowards(prev)
-		prev = rope.knots[i]
+		old := rope.knots[moved]
+		rope.knots[moved].MoveTowards(prev)
+		prev = rope.knots[moved]
+		if prev != old.Plus(dir.delta, 1) {
+			rigid = false
+		}
+	}
+	return
+}
+
+func (rope *Rope) Translate(delta Pos, times int) {
+	for i := range rope.knots {
+		rope.knots[i].Add(delta, times)
 	}
 }
 
@@ -154,25 +288,361 @@ func (rope *Rope) Tail() *Pos {
 	return &rope.knots[len(rope.knots)-1]
 }
 
+func (rope *Rope) Knot(i int) *Pos {
+	return &rope.knots[i]
+}
+
+func (rope *Rope) KnotCount() int {
+	return len(rope.knots)
+}
+
+func CanonicalLineDirection(delta Pos) Pos {
+	for i := range delta {
+		if delta[i] > 0 {
+			return delta
+		} else if delta[i] < 0 {
+			var result Pos
+			result.Add(delta, -1)
+			return result
+		}
+	}
+	panic("Zero direction")
+}
+
+func MakeLineFamily(dir Pos) (result LineFamily) {
+	result.dir = CanonicalLineDirection(dir)
+	for result.dir[result.axis] == 0 {
+		result.axis++
+	}
+	result.lines = make(map[Pos]*IntervalSet)
+	return
+}
+
+func (family *LineFamily) Locate(pos Pos) (base Pos, t int) {
+	t = pos[family.axis]
+	base = pos.Plus(family.dir, -t)
+	return
+}
+
+func (family *LineFamily) Point(base Pos, t int) Pos {
+	return base.Plus(family.dir, t)
+}
+
+func (family *LineFamily) Contains(pos Pos) bool {
+	base, t := family.Locate(pos)
+	line, ok := family.lines[base]
+	return ok && line.Contains(t)
+}
+
+func (family *LineFamily) Intersect(base Pos, other *LineFamily, otherBase Pos) (t, s int, ok bool) {
+	d, g := family.dir, other.dir
+	for a := 0; a < MaxDims; a++ {
+		for b := a + 1; b < MaxDims; b++ {
+			det := g[a]*d[b] - d[a]*g[b]
+			if det == 0 {
+				continue
+			}
+			ra, rb := otherBase[a]-base[a], otherBase[b]-base[b]
+			tNum, sNum := g[a]*rb-ra*g[b], d[a]*rb-ra*d[b]
+			if tNum%det != 0 || sNum%det != 0 {
+				return
+			}
+			t, s = tNum/det, sNum/det
+			ok = family.Point(base, t) == other.Point(otherBase, s)
+			return
+		}
+	}
+	return
+}
+
 func MakePositionMap() (result PositionMap) {
-	result.visited = make(map[Pos]bool)
+	result.families = make(map[Pos]*LineFamily)
 	return
 }
 
+func (posmap *PositionMap) Family(delta Pos) *LineFamily {
+	dir := CanonicalLineDirection(delta)
+	family, ok := posmap.families[dir]
+	if !ok {
+		newFamily := MakeLineFamily(dir)
+		family = &newFamily
+		posmap.families[dir] = family
+		posmap.order = append(posmap.order, family)
+	}
+	return family
+}
+
+func (posmap *PositionMap) coveredElsewhere(pos Pos, except *LineFamily) bool {
+	for _, family := range posmap.order {
+		if family != except && family.Contains(pos) {
+			return true
+		}
+	}
+	return false
+}
+
 func (posmap *PositionMap) MarkPos(pos Pos) {
-	posmap.visited[pos] = true
+	posmap.MarkSegment(pos, DirRight.Delta(), 1)
+}
+
+func (posmap *PositionMap) MarkSegment(start, delta Pos, count int) {
+	if count <= 0 {
+		return
+	}
+	end := start.Plus(delta, count-1)
+
+	if posmap.marks == 0 {
+		posmap.min, posmap.max = start, start
+	}
+	for _, pos := range [...]Pos{start, end} {
+		for i := range pos {
+			posmap.min[i] = Min(posmap.min[i], pos[i])
+			posmap.max[i] = Max(posmap.max[i], pos[i])
+		}
+	}
+	posmap.marks += count
+
+	family := posmap.Family(delta)
+	base, lo := family.Locate(start)
+	_, hi := family.Locate(end)
+	if lo > hi {
+		lo, hi = hi, lo
+	}
+	hi++
+
+	line, ok := family.lines[base]
+	if !ok {
+		line = new(IntervalSet)
+		family.lines[base] = line
+		posmap.lineCount++
+	}
+
+	uncovered := line.Uncovered(lo, hi)
+	fresh := 0
+	for _, iv := range uncovered {
+		fresh += iv.Len()
+	}
+
+	duplicates := 0
+	otherLines := posmap.lineCount - len(family.lines)
+	if otherLines > 0 && fresh*(len(posmap.order)-1) <= otherLines {
+		for _, iv := range uncovered {
+			for t := iv.Lo; t < iv.Hi; t++ {
+				if posmap.coveredElsewhere(family.Point(base, t), family) {
+					duplicates++
+				}
+			}
+		}
+	} else if otherLines > 0 {
+		inUncovered := func(t int) bool {
+			i := sort.Search(len(uncovered), func(i int) bool {
+				return uncovered[i].Hi > t
+			})
+			return i < len(uncovered) && uncovered[i].Lo <= t
+		}
+		seen := make(map[Pos]bool)
+		for _, other := range posmap.order {
+			if other == family {
+				continue
+			}
+			for otherBase, otherLine := range other.lines {
+				t, s, ok := family.Intersect(base, other, otherBase)
+				if ok && inUncovered(t) && otherLine.Contains(s) {
+					seen[family.Point(base, t)] = true
+				}
+			}
+		}
+		duplicates = len(seen)
+	}
+
+	line.Insert(lo, hi)
+	posmap.visited += fresh - duplicates
+}
+
+func (posmap *PositionMap) VisitedCount() int {
+	return posmap.visited
+}
+
+func (posmap *PositionMap) Marks() int {
+	return posmap.marks
+}
+
+func (posmap *PositionMap) Revisits() int {
+	return posmap.marks - posmap.VisitedCount()
+}
+
+func (posmap *PositionMap) Bounds() (min, max Pos) {
+	return posmap.min, posmap.max
+}
+
+func (posmap *PositionMap) Dims() int {
+	return Max(posmap.min.Dims(), posmap.max.Dims())
 }
 
 func (posmap *PositionMap) TraverseVisited(cb func(Pos)) {
-	for k, v := range posmap.visited {
-		if v {
-			cb(k)
+	for i, family := range posmap.order {
+		for base, line := range family.lines {
+			line.Traverse(func(iv Interval) {
+			outer:
+				for t := iv.Lo; t < iv.Hi; t++ {
+					pos := family.Point(base, t)
+					for _, prev := range posmap.order[:i] {
+						if prev.Contains(pos) {
+							continue outer
+						}
+					}
+					cb(pos)
+				}
+			})
+		}
+	}
+}
+
+func MakeKnotTracker(rope *Rope) (result KnotTracker) {
+	result.maps = make([]PositionMap, rope.KnotCount())
+	for i := range result.maps {
+		result.maps[i] = MakePositionMap()
+		result.maps[i].MarkPos(*rope.Knot(i))
+	}
+	return
+}
+
+func (tracker *KnotTracker) Mark(rope *Rope, moved int) {
+	for i := 0; i < moved; i++ {
+		tracker.maps[i].MarkPos(*rope.Knot(i))
+	}
+}
+
+func (tracker *KnotTracker) MarkTranslation(rope *Rope, dir Direction, steps int) {
+	for i := range tracker.maps {
+		tracker.maps[i].MarkSegment(rope.Knot(i).Plus(dir.delta, 1), dir.delta, steps)
+	}
+	rope.Translate(dir.delta, steps)
+}
+
+func (tracker *KnotTracker) ApplyMotion(rope *Rope, motion Motion) {
+	for i := 0; i < motion.Steps; i++ {
+		moved, rigid := rope.ApplyDirection(motion.Dir)
+		tracker.Mark(rope, moved)
+		if rigid {
+			tracker.MarkTranslation(rope, motion.Dir, motion.Steps-i-1)
+			return
+		}
+	}
+}
+
+func (tracker *KnotTracker) Knot(i int) *PositionMap {
+	return &tracker.maps[i]
+}
+
+func (tracker *KnotTracker) KnotCount() int {
+	return len(tracker.maps)
+}
+
+func (tracker *KnotTracker) Dims() (result int) {
+	result = 2
+	for i := range tracker.maps {
+		result = Max(result, tracker.Knot(i).Dims())
+	}
+	return
+}
+
+func (tracker *KnotTracker) PrintStats(out io.Writer) {
+	dims := tracker.Dims()
+	for i := range tracker.maps {
+		posmap := tracker.Knot(i)
+		min, max := posmap.Bounds()
+		fmt.Fprintf(out, "knot %d: visited %d, bbox (%s)-(%s), revisits %d/%d (%.1f%%)\n",
+			i, posmap.VisitedCount(), min.Format(dims), max.Format(dims),
+			posmap.Revisits(), posmap.Marks(),
+			100*float64(posmap.Revisits())/float64(posmap.Marks()))
+	}
+}
+
+func (posmap *PositionMap) SortedVisited() (result []Pos) {
+	result = make([]Pos, 0, posmap.VisitedCount())
+	posmap.TraverseVisited(func(pos Pos) {
+		result = append(result, pos)
+	})
+	sort.Slice(result, func(i, j int) bool {
+		for axis := MaxDims - 1; axis > AxisY; axis-- {
+			if result[i][axis] != result[j][axis] {
+				return result[i][axis] < result[j][axis]
+			}
+		}
+		if result[i][AxisY] != result[j][AxisY] {
+			return result[i][AxisY] > result[j][AxisY]
+		}
+		return result[i][AxisX] < result[j][AxisX]
+	})
+	return
+}
+
+func (tracker *KnotTracker) WriteCsv(out io.Writer) {
+	dims := tracker.Dims()
+	header := "knot"
+	for axis := 0; axis < dims; axis++ {
+		if axis < len(AxisNames) {
+			header += "," + strings.ToLower(AxisNames[axis:axis+1])
+		} else {
+			header += fmt.Sprintf(",a%d", axis)
+		}
+	}
+	fmt.Fprintln(out, header)
+	for i := range tracker.maps {
+		for _, pos := range tracker.Knot(i).SortedVisited() {
+			fmt.Fprintf(out, "%d,%s\n", i, pos.Format(dims))
+		}
+	}
+}
+
+func (posmap *PositionMap) WritePbm(out io.Writer) {
+	var plane Pos
+	projected := make(map[Pos]bool)
+	posmap.TraverseVisited(func(pos Pos) {
+		plane[AxisX], plane[AxisY] = pos[AxisX], pos[AxisY]
+		projected[plane] = true
+	})
+
+	min, max := posmap.Bounds()
+	width := max[AxisX] - min[AxisX] + 1
+	fmt.Fprintf(out, "P1\n%d %d\n", width, max[AxisY]-min[AxisY]+1)
+	row := make([]byte, 2*width)
+	for y := max[AxisY]; y >= min[AxisY]; y-- {
+		for x := min[AxisX]; x <= max[AxisX]; x++ {
+			plane[AxisX], plane[AxisY] = x, y
+			i := 2 * (x - min[AxisX])
+			row[i] = '0'
+			if projected[plane] {
+				row[i] = '1'
+			}
+			row[i+1] = ' '
+		}
+		row[len(row)-1] = '\n'
+		out.Write(row)
+	}
+}
+
+func (tracker *KnotTracker) WritePbmFiles(prefix string) {
+	for i := range tracker.maps {
+		f, err := os.Create(fmt.Sprintf("%s%d.pbm", prefix, i))
+		if err != nil {
+			panic(err)
+		}
+		w := bufio.NewWriter(f)
+		tracker.Knot(i).WritePbm(w)
+		if err = w.Flush(); err != nil {
+			panic(err)
+		}
+		if err = f.Close(); err != nil {
+			panic(err)
 		}
 	}
 }
 
 func main() {
 	knotCount := 2
+	output := ""
 
 	if len(os.Args) > 1 {
 		var err error
@@ -181,24 +651,35 @@ func main() {
 			panic(err)
 		}
 	}
+	if len(os.Args) > 2 {
+		output = os.Args[2]
+	}
 
 	scanner := bufio.NewScanner(os.Stdin)
 	rope := MakeRope(knotCount)
-	posmap := MakePositionMap()
-
-	posmap.MarkPos(*rope.Tail())
+	tracker := MakeKnotTracker(&rope)
 
 	for scanner.Scan() {
 		line := strings.TrimSpace(scanner.Text())
-		motion := ParseMotion(line)
-		for i := 0; i < motion.Steps; i++ {
-			rope.ApplyDirection(motion.Dir)
-			posmap.MarkPos(*rope.Tail())
+		tracker.ApplyMotion(&rope, ParseMotion(line))
+	}
+
+	switch output {
+	case "":
+		fmt.Println(tracker.Knot(knotCount - 1).VisitedCount())
+	case "stats":
+		tracker.PrintStats(os.Stdout)
+	case "csv":
+		w := bufio.NewWriter(os.Stdout)
+		tracker.WriteCsv(w)
+		w.Flush()
+	case "pbm":
+		prefix := "knot"
+		if len(os.Args) > 3 {
+			prefix = os.Args[3]
 		}
+		tracker.WritePbmFiles(prefix)
+	default:
+		panic("Unknown output mode")
 	}
-	visited := 0
-	posmap.TraverseVisited(func(Pos) {
-		visited++
-	})
-	fmt.Println(visited)
 }
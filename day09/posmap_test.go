@@ -0,0 +1,74 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+)
+
+type segment struct {
+	start Pos
+	dir   Direction
+	count int
+}
+
+// AssertSegments marks the segments one by one and checks the visited count
+// after every segment against a brute-force set of positions.
+func AssertSegments(t *testing.T, segments []segment) {
+	posmap := MakePositionMap()
+	brute := map[Pos]bool{}
+	for i, seg := range segments {
+		posmap.MarkSegment(seg.start, seg.dir.Delta(), seg.count)
+		for j := 0; j < seg.count; j++ {
+			brute[seg.start.Plus(seg.dir.Delta(), j)] = true
+		}
+		if posmap.VisitedCount() != len(brute) {
+			t.Fatalf("AssertSegments(t, %v): %d visited after segment %d, expected %d", segments, posmap.VisitedCount(), i, len(brute))
+		}
+	}
+
+	traversed := 0
+	posmap.TraverseVisited(func(pos Pos) {
+		if !brute[pos] {
+			t.Fatalf("AssertSegments(t, %v): %v traversed but not visited", segments, pos)
+		}
+		traversed++
+	})
+	if traversed != len(brute) {
+		t.Fatalf("AssertSegments(t, %v): %d traversed, expected %d", segments, traversed, len(brute))
+	}
+}
+
+func TestMarkSegment(t *testing.T) {
+	for _, segments := range [][]segment{
+		{{Pos{0, 0}, DirRight, 5}, {Pos{2, -2}, DirUp, 5}},
+		{{Pos{0, 0}, DirRight, 5}, {Pos{4, 0}, DirLeft, 10}},
+		{{Pos{0, 0}, DirUpRight, 5}, {Pos{0, 4}, DirDownRight, 5}, {Pos{0, 2}, DirRight, 5}},
+		{{Pos{0, 0}, DirUpRight, 4}, {Pos{0, 1}, DirUpRight, 4}, {Pos{1, 0}, DirUp, 4}},
+		{{Pos{3, 3}, DirDownLeft, 7}, {Pos{0, 0}, DirUp, 1}, {Pos{-3, -3}, DirUpLeft, 3}},
+		{{Pos{0, 0, 0}, AxisDirection(AxisZ, 1), 4}, {Pos{0, 0, 2}, DirRight, 3}, {Pos{0, 0, 2}, DirUp, 3}},
+	} {
+		AssertSegments(t, segments)
+	}
+
+	rng := rand.New(rand.NewSource(28))
+	dirs := []Direction{DirUp, DirDown, DirLeft, DirRight, DirUpLeft, DirUpRight, DirDownLeft, DirDownRight}
+	for i := 0; i < 200; i++ {
+		segments := []segment{}
+		for j := 0; j < 1+rng.Intn(40); j++ {
+			start := Pos{rng.Intn(21) - 10, rng.Intn(21) - 10}
+			segments = append(segments, segment{start, dirs[rng.Intn(len(dirs))], 1 + rng.Intn(12)})
+		}
+		AssertSegments(t, segments)
+	}
+}
+
+func TestBatching(t *testing.T) {
+	AssertVisits(t, 10, ParseMotions("R 5\nU 8\nL 8\nD 3\nR 17\nD 10\nL 25\nU 20"))
+	AssertVisits(t, 10, ParseMotions("R 100\nUL 50\nD 80\nDR 30\nL 100"))
+
+	rng := rand.New(rand.NewSource(26))
+	dirs := []Direction{DirUp, DirDown, DirLeft, DirRight, DirUpLeft, DirUpRight, DirDownLeft, DirDownRight}
+	for i := 0; i < 50; i++ {
+		AssertVisits(t, 2+rng.Intn(9), RandomMotions(rng, dirs, 40, 30))
+	}
+}
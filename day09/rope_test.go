@@ -0,0 +1,82 @@
+package main
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// NaiveVisits moves the rope one step at a time and records every knot
+// position in a map.
+func NaiveVisits(knotCount int, motions []Motion) []int {
+	rope := MakeRope(knotCount)
+	visited := make([]map[Pos]bool, knotCount)
+	for i := range visited {
+		visited[i] = map[Pos]bool{*rope.Knot(i): true}
+	}
+	for _, motion := range motions {
+		for step := 0; step < motion.Steps; step++ {
+			rope.ApplyDirection(motion.Dir)
+			for i := range visited {
+				visited[i][*rope.Knot(i)] = true
+			}
+		}
+	}
+	result := make([]int, knotCount)
+	for i := range visited {
+		result[i] = len(visited[i])
+	}
+	return result
+}
+
+func AssertVisits(t *testing.T, knotCount int, motions []Motion) {
+	rope := MakeRope(knotCount)
+	tracker := MakeKnotTracker(&rope)
+	for _, motion := range motions {
+		tracker.ApplyMotion(&rope, motion)
+	}
+	for i, expected := range NaiveVisits(knotCount, motions) {
+		if got := tracker.Knot(i).VisitedCount(); got != expected {
+			t.Fatalf("AssertVisits(t, %d, %v): knot %d visited %d positions, expected %d", knotCount, motions, i, got, expected)
+		}
+	}
+}
+
+func ParseMotions(src string) (result []Motion) {
+	for _, line := range strings.Split(strings.TrimSpace(src), "\n") {
+		result = append(result, ParseMotion(line))
+	}
+	return
+}
+
+func RandomMotions(rng *rand.Rand, dirs []Direction, count, maxSteps int) (result []Motion) {
+	for i := 0; i < count; i++ {
+		result = append(result, Motion{dirs[rng.Intn(len(dirs))], 1 + rng.Intn(maxSteps)})
+	}
+	return
+}
+
+func TestDimensions(t *testing.T) {
+	AssertVisits(t, 3, ParseMotions("+Z 4\n+X 3\n-Y 2\n+W 5\n-Z 7\n+A7 3\nUL 2"))
+
+	rng := rand.New(rand.NewSource(27))
+	dirs := []Direction{}
+	for axis := 0; axis < 4; axis++ {
+		dirs = append(dirs, AxisDirection(axis, 1), AxisDirection(axis, -1))
+	}
+	for i := 0; i < 50; i++ {
+		AssertVisits(t, 2+rng.Intn(9), RandomMotions(rng, dirs, 30, 6))
+	}
+}
+
+func TestAxisLimit(t *testing.T) {
+	if ParseAxis("A7") != MaxDims-1 || ParseAxis("W") != AxisW {
+		t.Fatalf("TestAxisLimit: wrong axes")
+	}
+	defer func() {
+		if r := recover(); r == nil || !strings.Contains(r.(string), "at most 8 dimensions") {
+			t.Fatalf("TestAxisLimit: got %v instead of an out of range panic", r)
+		}
+	}()
+	ParseDirection("+A8")
+}
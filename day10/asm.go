@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type AsmError struct {
+	Line int
+	Msg  string
+}
+
+type AsmErrors []AsmError
+
+type Assembler struct {
+	program []Instruction
+	labels  map[string]int
+	errors  AsmErrors
+	label   *regexp.Regexp
+}
+
+func (err AsmError) Error() string {
+	return fmt.Sprintf("line %d: %s", err.Line, err.Msg)
+}
+
+func (errs AsmErrors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+func MakeAssembler() (result Assembler) {
+	result.program = []Instruction{}
+	result.labels = make(map[string]int)
+	result.label = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_]*):\s*(.*)$`)
+	return
+}
+
+func (asm *Assembler) errorf(line int, format string, args ...any) {
+	asm.errors = append(asm.errors, AsmError{line, fmt.Sprintf(format, args...)})
+}
+
+func ParseRegister(s string) (Register, bool) {
+	for reg, name := range RegisterNames {
+		if s == name {
+			return Register(reg), true
+		}
+	}
+	return 0, false
+}
+
+func ParseOperand(s string) (result Operand, ok bool) {
+	result.Reg, result.IsReg = ParseRegister(s)
+	if result.IsReg {
+		return result, true
+	}
+	var err error
+	result.Value, err = strconv.Atoi(s)
+	return result, err == nil
+}
+
+func ParseInstruction(str string) (result Instruction, err error) {
+	fields := strings.FieldsFunc(str, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t'
+	})
+	if len(fields) == 0 {
+		err = fmt.Errorf("instruction expected")
+		return
+	}
+
+	found := false
+	for t := InstructionType(0); t < InstrCount; t++ {
+		if t.Spec().Name == fields[0] {
+			result.Type = t
+			found = true
+			break
+		}
+	}
+	if !found {
+		err = fmt.Errorf("unknown instruction %q", fields[0])
+		return
+	}
+
+	args := result.Type.Spec().Args
+	if len(fields)-1 != len(args) {
+		err = fmt.Errorf("%s: %d arguments expected, got %d", fields[0], len(args), len(fields)-1)
+		return
+	}
+
+	for i, kind := range args {
+		arg := fields[i+1]
+		ok := true
+		switch kind {
+		case 'R':
+			result.Dst, ok = ParseRegister(arg)
+		case 'V':
+			result.Src, ok = ParseOperand(arg)
+		case 'L':
+			result.Label = arg
+		}
+		if !ok {
+			err = fmt.Errorf("%s: invalid argument %q", fields[0], arg)
+			return
+		}
+	}
+	return
+}
+
+func (asm *Assembler) AddLine(lineNo int, line string) {
+	if i := strings.IndexByte(line, ';'); i >= 0 {
+		line = line[:i]
+	}
+	line = strings.TrimSpace(line)
+
+	if matches := asm.label.FindStringSubmatch(line); matches != nil {
+		name := matches[1]
+		if _, exists := asm.labels[name]; exists {
+			asm.errorf(lineNo, "label %q redefined", name)
+		}
+		asm.labels[name] = len(asm.program)
+		line = matches[2]
+	}
+	if line == "" {
+		return
+	}
+
+	instr, err := ParseInstruction(line)
+	if err != nil {
+		asm.errorf(lineNo, "%v", err)
+		return
+	}
+	instr.Line = lineNo
+	asm.program = append(asm.program, instr)
+}
+
+func (asm *Assembler) Resolve() {
+	for i := range asm.program {
+		instr := &asm.program[i]
+		if instr.Label == "" {
+			continue
+		}
+		target, ok := asm.labels[instr.Label]
+		if !ok {
+			asm.errorf(instr.Line, "undefined label %q", instr.Label)
+			continue
+		}
+		instr.Target = target
+	}
+}
+
+func Assemble(scanner *bufio.Scanner) ([]Instruction, error) {
+	asm := MakeAssembler()
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		asm.AddLine(lineNo, scanner.Text())
+	}
+	asm.Resolve()
+
+	if len(asm.errors) > 0 {
+		sort.SliceStable(asm.errors, func(i, j int) bool {
+			return asm.errors[i].Line < asm.errors[j].Line
+		})
+		return nil, asm.errors
+	}
+	return asm.program, nil
+}
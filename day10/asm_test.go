@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+func AssembleString(t *testing.T, src string) []Instruction {
+	program, err := Assemble(bufio.NewScanner(strings.NewReader(src)))
+	if err != nil {
+		t.Fatalf("Assemble(%q): err %v", src, err)
+	}
+	return program
+}
+
+func AssertAsmErrors(t *testing.T, src string, expected []int) {
+	_, err := Assemble(bufio.NewScanner(strings.NewReader(src)))
+	errs, ok := err.(AsmErrors)
+	if !ok {
+		t.Fatalf("AssertAsmErrors(t, %q, %v): got %v", src, expected, err)
+	}
+	if len(errs) != len(expected) {
+		t.Fatalf("AssertAsmErrors(t, %q, %v): got %v", src, expected, errs)
+	}
+	for i, line := range expected {
+		if errs[i].Line != line {
+			t.Fatalf("AssertAsmErrors(t, %q, %v): got %v", src, expected, errs)
+		}
+	}
+}
+
+func TestLoop(t *testing.T) {
+	program := AssembleString(t, `
+		mov a 4
+	loop:	mul x 2 ; doubles X
+		sub a 1
+		jnz a loop
+		mov b x
+	`)
+
+	cpu := MakeCpu(program)
+	for cpu.NextCycle() {
+	}
+
+	if cpu.X() != 16 || cpu.Reg(RegA) != 0 || cpu.Reg(RegB) != 16 {
+		t.Fatalf("Unexpected registers %v", cpu.regs)
+	}
+
+	expected := 1 + 4*(3+2+2) + 1
+	if cpu.Cycle() != expected {
+		t.Fatalf("Finished at cycle %d instead of %d", cpu.Cycle(), expected)
+	}
+}
+
+func TestAddxTiming(t *testing.T) {
+	cpu := MakeCpu(AssembleString(t, "noop\naddx 3\naddx -5\n"))
+	expected := []int{1, 1, 1, 4, 4}
+	for i, x := range expected {
+		if cpu.Cycle() != i+1 || cpu.X() != x {
+			t.Fatalf("Cycle %d: X=%d, expected cycle %d with X=%d", cpu.Cycle(), cpu.X(), i+1, x)
+		}
+		if cpu.NextCycle() != (i+1 < len(expected)) {
+			t.Fatalf("Unexpected end of program at cycle %d", cpu.Cycle())
+		}
+	}
+	if cpu.X() != -1 {
+		t.Fatalf("X=%d at the end, expected -1", cpu.X())
+	}
+}
+
+func TestErrors(t *testing.T) {
+	AssertAsmErrors(t, "mov q 1\nfoo 3\njmp nowhere\naddx\nl:\nl: noop\n", []int{1, 2, 3, 4, 6})
+}
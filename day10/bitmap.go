@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"strings"
+)
+
+type Bitmap struct {
+	width, height int
+	pixels        []bool
+}
+
+func MakeBitmap(width, height int) (result Bitmap) {
+	result.width = width
+	result.height = height
+	result.pixels = make([]bool, width*height)
+	return
+}
+
+func (bmp *Bitmap) Width() int {
+	return bmp.width
+}
+
+func (bmp *Bitmap) Height() int {
+	return bmp.height
+}
+
+func (bmp *Bitmap) InBounds(x, y int) bool {
+	return x >= 0 && x < bmp.width && y >= 0 && y < bmp.height
+}
+
+func (bmp *Bitmap) At(x, y int) bool {
+	if !bmp.InBounds(x, y) {
+		return false
+	}
+	return bmp.pixels[y*bmp.width+x]
+}
+
+func (bmp *Bitmap) Set(x, y int, lit bool) {
+	if !bmp.InBounds(x, y) {
+		panic("Out of bounds")
+	}
+	bmp.pixels[y*bmp.width+x] = lit
+}
+
+func (bmp *Bitmap) Copy() (result Bitmap) {
+	result = *bmp
+	result.pixels = make([]bool, len(bmp.pixels))
+	copy(result.pixels, bmp.pixels)
+	return
+}
+
+func (bmp *Bitmap) Clear() {
+	for i := range bmp.pixels {
+		bmp.pixels[i] = false
+	}
+}
+
+func (bmp *Bitmap) String() string {
+	var sb strings.Builder
+	for y := 0; y < bmp.height; y++ {
+		for x := 0; x < bmp.width; x++ {
+			sb.WriteByte(PixelChar(bmp.At(x, y)))
+		}
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+func ParseBitmap(scanner *bufio.Scanner) (result Bitmap, err error) {
+	rows := []string{}
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if len(rows) > 0 && len(line) != len(rows[0]) {
+			err = errors.New("Row size mismatch")
+			return
+		}
+		rows = append(rows, line)
+	}
+	if len(rows) == 0 {
+		err = errors.New("Empty bitmap")
+		return
+	}
+
+	result = MakeBitmap(len(rows[0]), len(rows))
+	for y, row := range rows {
+		for x := 0; x < len(row); x++ {
+			switch row[x] {
+			case '#':
+				result.Set(x, y, true)
+			case '.':
+			default:
+				err = errors.New("Bitmap must consist of '#' and '.'")
+				return
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+)
+
+type InstructionType int
+
+const (
+	InstrNoop InstructionType = iota
+	InstrAddx
+	InstrMov
+	InstrAdd
+	InstrSub
+	InstrMul
+	InstrJmp
+	InstrJnz
+	InstrCount
+)
+
+type InstructionSpec struct {
+	Name   string
+	Cycles int
+	Args   string
+}
+
+// Args lists the operand kinds in order: R is a register, V is a register
+// or an integer literal, L is a label.
+var InstructionSpecs = [InstrCount]InstructionSpec{
+	InstrNoop: {"noop", 1, ""},
+	InstrAddx: {"addx", 2, "V"},
+	InstrMov:  {"mov", 1, "RV"},
+	InstrAdd:  {"add", 2, "RV"},
+	InstrSub:  {"sub", 2, "RV"},
+	InstrMul:  {"mul", 3, "RV"},
+	InstrJmp:  {"jmp", 2, "L"},
+	InstrJnz:  {"jnz", 2, "VL"},
+}
+
+type Register int
+
+const (
+	RegX Register = iota
+	RegA
+	RegB
+	RegC
+	RegD
+	RegCount
+)
+
+var RegisterNames = [RegCount]string{"x", "a", "b", "c", "d"}
+
+type Operand struct {
+	IsReg bool
+	Reg   Register
+	Value int
+}
+
+type Instruction struct {
+	Type   InstructionType
+	Dst    Register
+	Src    Operand
+	Label  string
+	Target int
+	Line   int
+}
+
+type Cpu struct {
+	cycle     int
+	regs      [RegCount]int
+	program   []Instruction
+	pc        int
+	current   *Instruction
+	remaining int
+	buffer    int
+	retired   int
+}
+
+func (t InstructionType) Spec() InstructionSpec {
+	return InstructionSpecs[t]
+}
+
+func (t InstructionType) String() string {
+	return t.Spec().Name
+}
+
+func (reg Register) String() string {
+	return RegisterNames[reg]
+}
+
+func (op Operand) String() string {
+	if op.IsReg {
+		return op.Reg.String()
+	}
+	return strconv.Itoa(op.Value)
+}
+
+func (instr Instruction) String() (result string) {
+	result = instr.Type.String()
+	for _, kind := range instr.Type.Spec().Args {
+		switch kind {
+		case 'R':
+			result += " " + instr.Dst.String()
+		case 'V':
+			result += " " + instr.Src.String()
+		case 'L':
+			result += " " + instr.Label
+		}
+	}
+	return
+}
+
+func MakeCpu(program []Instruction) (result Cpu) {
+	result.cycle = 1
+	result.regs[RegX] = 1
+	result.program = program
+	result.fetch()
+	return
+}
+
+func (cpu *Cpu) Cycle() int {
+	return cpu.cycle
+}
+
+func (cpu *Cpu) X() int {
+	return cpu.regs[RegX]
+}
+
+func (cpu *Cpu) Reg(reg Register) int {
+	return cpu.regs[reg]
+}
+
+func (cpu *Cpu) PC() int {
+	return cpu.pc
+}
+
+func (cpu *Cpu) Current() *Instruction {
+	return cpu.current
+}
+
+func (cpu *Cpu) Buffer() int {
+	return cpu.buffer
+}
+
+func (cpu *Cpu) Remaining() int {
+	return cpu.remaining
+}
+
+func (cpu *Cpu) Retired() int {
+	return cpu.retired
+}
+
+func (cpu *Cpu) Finished() bool {
+	return cpu.current == nil
+}
+
+func (cpu *Cpu) operand(op Operand) int {
+	if op.IsReg {
+		return cpu.regs[op.Reg]
+	}
+	return op.Value
+}
+
+func (cpu *Cpu) fetch() bool {
+	if cpu.pc >= len(cpu.program) {
+		cpu.current = nil
+		return false
+	}
+	cpu.current = &cpu.program[cpu.pc]
+	cpu.pc++
+	cpu.remaining = cpu.current.Type.Spec().Cycles
+	cpu.buffer = cpu.operand(cpu.current.Src)
+	return true
+}
+
+func (cpu *Cpu) execute(instr *Instruction) {
+	switch instr.Type {
+	case InstrNoop:
+	case InstrAddx:
+		cpu.regs[RegX] += cpu.buffer
+	case InstrMov:
+		cpu.regs[instr.Dst] = cpu.buffer
+	case InstrAdd:
+		cpu.regs[instr.Dst] += cpu.buffer
+	case InstrSub:
+		cpu.regs[instr.Dst] -= cpu.buffer
+	case InstrMul:
+		cpu.regs[instr.Dst] *= cpu.buffer
+	case InstrJmp:
+		cpu.pc = instr.Target
+	case InstrJnz:
+		if cpu.buffer != 0 {
+			cpu.pc = instr.Target
+		}
+	default:
+		panic(fmt.Sprintf("Invalid instruction type %d", instr.Type))
+	}
+}
+
+func (cpu *Cpu) NextCycle() bool {
+	if cpu.current == nil {
+		return false
+	}
+
+	cpu.remaining--
+	if cpu.remaining == 0 {
+		cpu.execute(cpu.current)
+		cpu.retired++
+		if !cpu.fetch() {
+			return false
+		}
+	}
+
+	cpu.cycle++
+	return true
+}
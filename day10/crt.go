@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type CrtGeometry struct {
+	Width, Height int
+	SpriteWidth   int
+}
+
+var DefaultCrtGeometry = CrtGeometry{40, 6, 3}
+
+type Crt struct {
+	geometry   CrtGeometry
+	pos        int
+	row        int
+	silent     bool
+	keepFrames bool
+	dirty      bool
+	screen     Bitmap
+	frames     []Bitmap
+}
+
+func (geom CrtGeometry) Pixels() int {
+	return geom.Width * geom.Height
+}
+
+func (geom CrtGeometry) SpriteLeft(center int) int {
+	return center - (geom.SpriteWidth-1)/2
+}
+
+func (geom CrtGeometry) ShouldBeLit(pos, center int) bool {
+	left := geom.SpriteLeft(center)
+	return pos >= left && pos < left+geom.SpriteWidth
+}
+
+func MakeCrt(geometry CrtGeometry, silent bool) (result Crt) {
+	if geometry.Width <= 0 || geometry.Height <= 0 || geometry.SpriteWidth < 0 {
+		panic("Invalid CRT geometry")
+	}
+	result.geometry = geometry
+	result.silent = silent
+	result.screen = MakeBitmap(geometry.Width, geometry.Height)
+	return
+}
+
+func (crt *Crt) KeepFrames() {
+	crt.keepFrames = true
+}
+
+func (crt *Crt) Geometry() CrtGeometry {
+	return crt.geometry
+}
+
+func (crt *Crt) Pos() int {
+	return crt.pos
+}
+
+func (crt *Crt) Row() int {
+	return crt.row
+}
+
+func (crt *Crt) Screen() *Bitmap {
+	return &crt.screen
+}
+
+func (crt *Crt) ShouldBeLit(center int) bool {
+	return crt.geometry.ShouldBeLit(crt.pos, center)
+}
+
+func PixelChar(lit bool) byte {
+	if lit {
+		return '#'
+	}
+	return '.'
+}
+
+func (crt *Crt) Draw(lit bool) {
+	if !crt.silent && crt.keepFrames && !crt.dirty && len(crt.frames) > 0 {
+		fmt.Println()
+	}
+	crt.screen.Set(crt.pos, crt.row, lit)
+	crt.dirty = true
+	if !crt.silent {
+		fmt.Printf("%c", PixelChar(lit))
+	}
+	crt.pos++
+	if crt.pos == crt.geometry.Width {
+		if !crt.silent {
+			fmt.Println()
+		}
+		crt.pos = 0
+		crt.row++
+		if crt.row == crt.geometry.Height {
+			crt.row = 0
+			crt.finishFrame()
+		}
+	}
+}
+
+func (crt *Crt) finishFrame() {
+	if !crt.keepFrames || !crt.dirty {
+		return
+	}
+	crt.frames = append(crt.frames, crt.screen.Copy())
+	crt.screen.Clear()
+	crt.dirty = false
+}
+
+func (crt *Crt) Frames() []Bitmap {
+	if !crt.keepFrames {
+		return []Bitmap{crt.screen}
+	}
+	crt.finishFrame()
+	return crt.frames
+}
+
+func WritePbm(bmp *Bitmap, out io.Writer) error {
+	w := bufio.NewWriter(out)
+	fmt.Fprintf(w, "P1\n%d %d\n", bmp.Width(), bmp.Height())
+	for y := 0; y < bmp.Height(); y++ {
+		for x := 0; x < bmp.Width(); x++ {
+			if x > 0 {
+				w.WriteByte(' ')
+			}
+			if bmp.At(x, y) {
+				w.WriteByte('1')
+			} else {
+				w.WriteByte('0')
+			}
+		}
+		w.WriteByte('\n')
+	}
+	return w.Flush()
+}
+
+func WritePng(bmp *Bitmap, out io.Writer) error {
+	img := image.NewGray(image.Rect(0, 0, bmp.Width(), bmp.Height()))
+	for y := 0; y < bmp.Height(); y++ {
+		for x := 0; x < bmp.Width(); x++ {
+			if bmp.At(x, y) {
+				img.SetGray(x, y, color.Gray{0})
+			} else {
+				img.SetGray(x, y, color.Gray{255})
+			}
+		}
+	}
+	return png.Encode(out, img)
+}
+
+func SaveImage(bmp *Bitmap, path string) error {
+	var write func(*Bitmap, io.Writer) error
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".pbm":
+		write = WritePbm
+	case ".png":
+		write = WritePng
+	default:
+		return errors.New("Image file must have .pbm or .png extension")
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err = write(bmp, f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func FramePath(path string, frame int) string {
+	ext := filepath.Ext(path)
+	return fmt.Sprintf("%s-%03d%s", strings.TrimSuffix(path, ext), frame, ext)
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestScreen checks the part 2 example: the 240 cycles of the program draw
+// exactly one 40x6 screen, with no pixel past its end.
+func TestScreen(t *testing.T) {
+	f, err := os.Open("test_input")
+	if err != nil {
+		t.Fatalf("TestScreen: %v", err)
+	}
+	defer f.Close()
+	program, err := Assemble(bufio.NewScanner(f))
+	if err != nil {
+		t.Fatalf("TestScreen: %v", err)
+	}
+
+	cpu := MakeCpu(program)
+	crt := MakeCrt(DefaultCrtGeometry, true)
+	crt.KeepFrames()
+	RunCrt(&cpu, &crt)
+	frames := crt.Frames()
+	if len(frames) != 1 || crt.Pos() != 0 || crt.Row() != 0 {
+		t.Fatalf("TestScreen: %d frames, beam at row %d, column %d instead of one full screen", len(frames), crt.Row(), crt.Pos())
+	}
+
+	expected := strings.Join([]string{
+		"##..##..##..##..##..##..##..##..##..##..",
+		"###...###...###...###...###...###...###.",
+		"####....####....####....####....####....",
+		"#####.....#####.....#####.....#####.....",
+		"######......######......######......####",
+		"#######.......#######.......#######.....",
+	}, "\n") + "\n"
+	if got := frames[0].String(); got != expected {
+		t.Fatalf("TestScreen: expected\n%sgot\n%s", expected, got)
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type Debugger struct {
+	cpu         *Cpu
+	crt         Crt
+	breakpoints map[int]bool
+	watchpoints map[int]bool
+	watchAll    bool
+	in          *bufio.Scanner
+	out         io.Writer
+}
+
+const debuggerHelp = `Commands:
+  s, step [N]      run N cycles (default 1)
+  n, next [N]      run until N more instructions have completed (default 1)
+  c, continue      run until a breakpoint, a watchpoint or the end of the program
+  b, break CYCLE   stop when the given cycle starts
+  w, watch [X]     stop when X changes to the given value (any value if omitted)
+  d, delete        remove all breakpoints and watchpoints
+  i, info          list breakpoints and watchpoints
+  p, print         show the current state
+  q, quit          exit the debugger
+An empty line repeats the previous command.`
+
+func Trace(cpu *Cpu, geometry CrtGeometry, out io.Writer) {
+	crt := MakeCrt(geometry, true)
+	fmt.Fprintln(out, "cycle,x,instruction,pixel")
+	for {
+		instr := ""
+		if cpu.Current() != nil {
+			instr = cpu.Current().String()
+		}
+		lit := crt.ShouldBeLit(cpu.X())
+		fmt.Fprintf(out, "%d,%d,%s,%c\n", cpu.Cycle(), cpu.X(), instr, PixelChar(lit))
+		crt.Draw(lit)
+		if !cpu.NextCycle() {
+			break
+		}
+	}
+}
+
+func NewDebugger(cpu *Cpu, geometry CrtGeometry, in *bufio.Scanner, out io.Writer) (result *Debugger) {
+	result = new(Debugger)
+	result.cpu = cpu
+	result.crt = MakeCrt(geometry, true)
+	result.breakpoints = make(map[int]bool)
+	result.watchpoints = make(map[int]bool)
+	result.in = in
+	result.out = out
+	return
+}
+
+func (dbg *Debugger) PrintState() {
+	cpu := dbg.cpu
+	fmt.Fprintf(dbg.out, "cycle %d:", cpu.Cycle())
+	for reg := Register(0); reg < RegCount; reg++ {
+		fmt.Fprintf(dbg.out, " %v=%d", reg, cpu.Reg(reg))
+	}
+	fmt.Fprintln(dbg.out)
+
+	if instr := cpu.Current(); instr != nil {
+		fmt.Fprintf(dbg.out, "  instruction: %v (line %d), cycle %d of %d, buffer=%d\n",
+			instr, instr.Line, instr.Type.Spec().Cycles-cpu.Remaining()+1, instr.Type.Spec().Cycles, cpu.Buffer())
+	} else {
+		fmt.Fprintln(dbg.out, "  program finished")
+	}
+
+	lit := dbg.crt.ShouldBeLit(cpu.X())
+	fmt.Fprintf(dbg.out, "  beam: row %d, column %d, pixel %c\n", dbg.crt.Row(), dbg.crt.Pos(), PixelChar(lit))
+}
+
+func (dbg *Debugger) stepCycle() bool {
+	dbg.crt.Draw(dbg.crt.ShouldBeLit(dbg.cpu.X()))
+	return dbg.cpu.NextCycle()
+}
+
+func (dbg *Debugger) stopReason(prevX int) string {
+	cycle := dbg.cpu.Cycle()
+	if dbg.breakpoints[cycle] {
+		return fmt.Sprintf("breakpoint at cycle %d", cycle)
+	}
+	x := dbg.cpu.X()
+	if x != prevX && (dbg.watchAll || dbg.watchpoints[x]) {
+		return fmt.Sprintf("watchpoint: X changed from %d to %d", prevX, x)
+	}
+	return ""
+}
+
+func (dbg *Debugger) Advance(done func() bool) {
+	if dbg.cpu.Finished() {
+		fmt.Fprintln(dbg.out, "program is not running")
+		return
+	}
+	for {
+		prevX := dbg.cpu.X()
+		if !dbg.stepCycle() {
+			fmt.Fprintf(dbg.out, "program finished after cycle %d\n", dbg.cpu.Cycle())
+			return
+		}
+		if reason := dbg.stopReason(prevX); reason != "" {
+			fmt.Fprintln(dbg.out, reason)
+			break
+		}
+		if done() {
+			break
+		}
+	}
+	dbg.PrintState()
+}
+
+func (dbg *Debugger) PrintInfo() {
+	sorted := func(set map[int]bool) (result []int) {
+		for k := range set {
+			result = append(result, k)
+		}
+		sort.Ints(result)
+		return
+	}
+
+	fmt.Fprintf(dbg.out, "breakpoints: %v\n", sorted(dbg.breakpoints))
+	if dbg.watchAll {
+		fmt.Fprintln(dbg.out, "watchpoints: any change of X")
+	} else {
+		fmt.Fprintf(dbg.out, "watchpoints: %v\n", sorted(dbg.watchpoints))
+	}
+}
+
+func (dbg *Debugger) Execute(fields []string) (quit bool, err error) {
+	arg := func(def int) (int, error) {
+		if len(fields) < 2 {
+			return def, nil
+		}
+		return strconv.Atoi(fields[1])
+	}
+
+	var n int
+	switch fields[0] {
+	case "s", "step":
+		if n, err = arg(1); err == nil {
+			count := 0
+			dbg.Advance(func() bool {
+				count++
+				return count >= n
+			})
+		}
+	case "n", "next":
+		if n, err = arg(1); err == nil {
+			target := dbg.cpu.Retired() + n
+			dbg.Advance(func() bool {
+				return dbg.cpu.Retired() >= target
+			})
+		}
+	case "c", "continue":
+		dbg.Advance(func() bool {
+			return false
+		})
+	case "b", "break":
+		if len(fields) != 2 {
+			return false, fmt.Errorf("cycle number expected")
+		}
+		if n, err = arg(0); err == nil {
+			dbg.breakpoints[n] = true
+		}
+	case "w", "watch":
+		if len(fields) == 1 {
+			dbg.watchAll = true
+		} else if n, err = arg(0); err == nil {
+			dbg.watchpoints[n] = true
+		}
+	case "d", "delete":
+		dbg.breakpoints = make(map[int]bool)
+		dbg.watchpoints = make(map[int]bool)
+		dbg.watchAll = false
+	case "i", "info":
+		dbg.PrintInfo()
+	case "p", "print":
+		dbg.PrintState()
+	case "q", "quit":
+		quit = true
+	case "h", "help":
+		fmt.Fprintln(dbg.out, debuggerHelp)
+	default:
+		err = fmt.Errorf("unknown command %q, try \"help\"", fields[0])
+	}
+	return
+}
+
+func (dbg *Debugger) Run() {
+	dbg.PrintState()
+
+	var last []string
+	for {
+		fmt.Fprint(dbg.out, "(dbg) ")
+		if !dbg.in.Scan() {
+			fmt.Fprintln(dbg.out)
+			return
+		}
+
+		fields := strings.Fields(dbg.in.Text())
+		if len(fields) == 0 {
+			if last == nil {
+				continue
+			}
+			fields = last
+		}
+		last = fields
+
+		quit, err := dbg.Execute(fields)
+		if err != nil {
+			fmt.Fprintf(dbg.out, "error: %v\n", err)
+		}
+		if quit {
+			return
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+const GlyphWidth = 4
+const GlyphHeight = 6
+const GlyphStride = GlyphWidth + 1
+
+var fontGlyphs = map[rune][GlyphHeight]string{
+	'A': {".##.", "#..#", "#..#", "####", "#..#", "#..#"},
+	'B': {"###.", "#..#", "###.", "#..#", "#..#", "###."},
+	'C': {".##.", "#..#", "#...", "#...", "#..#", ".##."},
+	'E': {"####", "#...", "###.", "#...", "#...", "####"},
+	'F': {"####", "#...", "###.", "#...", "#...", "#..."},
+	'G': {".##.", "#..#", "#...", "#.##", "#..#", ".###"},
+	'H': {"#..#", "#..#", "####", "#..#", "#..#", "#..#"},
+	'I': {".###", "..#.", "..#.", "..#.", "..#.", ".###"},
+	'J': {"..##", "...#", "...#", "...#", "#..#", ".##."},
+	'K': {"#..#", "#.#.", "##..", "#.#.", "#.#.", "#..#"},
+	'L': {"#...", "#...", "#...", "#...", "#...", "####"},
+	'O': {".##.", "#..#", "#..#", "#..#", "#..#", ".##."},
+	'P': {"###.", "#..#", "#..#", "###.", "#...", "#..."},
+	'R': {"###.", "#..#", "#..#", "###.", "#.#.", "#..#"},
+	'S': {".###", "#...", "#...", ".##.", "...#", "###."},
+	'U': {"#..#", "#..#", "#..#", "#..#", "#..#", ".##."},
+	'Y': {"#...#", "#...#", ".#.#.", "..#..", "..#..", "..#.."},
+	'Z': {"####", "...#", "..#.", ".#..", "#...", "####"},
+}
+
+func glyphPixel(glyph *[GlyphHeight]string, x, y int) bool {
+	row := glyph[y]
+	return x < len(row) && row[x] == '#'
+}
+
+func matchGlyph(bmp *Bitmap, glyph *[GlyphHeight]string, left, top int) bool {
+	for y := 0; y < GlyphHeight; y++ {
+		for x := 0; x < GlyphStride; x++ {
+			if bmp.At(left+x, top+y) != glyphPixel(glyph, x, y) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func DecodeCell(bmp *Bitmap, left, top int) rune {
+	blank := [GlyphHeight]string{}
+	if matchGlyph(bmp, &blank, left, top) {
+		return ' '
+	}
+	for c, glyph := range fontGlyphs {
+		if matchGlyph(bmp, &glyph, left, top) {
+			return c
+		}
+	}
+	return '?'
+}
+
+func DecodeText(bmp *Bitmap) string {
+	lines := []string{}
+	for top := 0; top+GlyphHeight <= bmp.Height(); top += GlyphHeight {
+		line := []rune{}
+		for left := 0; left < bmp.Width(); left += GlyphStride {
+			line = append(line, DecodeCell(bmp, left, top))
+		}
+		lines = append(lines, strings.TrimRight(string(line), " "))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func RenderText(text string, width, height int) (result Bitmap, err error) {
+	result = MakeBitmap(width, height)
+	text = strings.ToUpper(text)
+	if height < GlyphHeight {
+		err = fmt.Errorf("%dx%d is too small for text", width, height)
+		return
+	}
+
+	for i, c := range []rune(text) {
+		if c == ' ' {
+			continue
+		}
+		glyph, ok := fontGlyphs[c]
+		if !ok {
+			err = fmt.Errorf("no glyph for %q", c)
+			return
+		}
+		for y := 0; y < GlyphHeight; y++ {
+			for x := 0; x < GlyphStride; x++ {
+				if !glyphPixel(&glyph, x, y) {
+					continue
+				}
+				if !result.InBounds(i*GlyphStride+x, y) {
+					err = fmt.Errorf("%q does not fit into %dx%d", text, width, height)
+					return
+				}
+				result.Set(i*GlyphStride+x, y, true)
+			}
+		}
+	}
+	return
+}
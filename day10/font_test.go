@@ -0,0 +1,47 @@
+package main
+
+import (
+	"testing"
+)
+
+func AssertRoundTrip(t *testing.T, geom CrtGeometry, text string) {
+	target, err := RenderText(text, geom.Width, geom.Height)
+	if err != nil {
+		t.Fatalf("AssertRoundTrip(t, %q): render err %v", text, err)
+	}
+	if decoded := DecodeText(&target); decoded != text {
+		t.Fatalf("AssertRoundTrip(t, %q): bitmap decoded as %q", text, decoded)
+	}
+
+	program, err := GenerateProgram(&target, geom.SpriteWidth)
+	if err != nil {
+		t.Fatalf("AssertRoundTrip(t, %q): generate err %v", text, err)
+	}
+
+	cpu := MakeCpu(program)
+	crt := MakeCrt(geom, true)
+	RunCrt(&cpu, &crt)
+	if cpu.Cycle() != geom.Pixels() {
+		t.Fatalf("AssertRoundTrip(t, %q): program ran for %d cycles", text, cpu.Cycle())
+	}
+	if decoded := DecodeText(crt.Screen()); decoded != text {
+		t.Fatalf("AssertRoundTrip(t, %q): screen decoded as %q:\n%v", text, decoded, crt.Screen())
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	AssertRoundTrip(t, DefaultCrtGeometry, "ZJHRKCPL")
+	AssertRoundTrip(t, DefaultCrtGeometry, "BUCACBUZ")
+	AssertRoundTrip(t, DefaultCrtGeometry, "EHPZPJGL")
+	AssertRoundTrip(t, DefaultCrtGeometry, "FOY")
+}
+
+func TestUnreachable(t *testing.T) {
+	target, err := RenderText("HI", 40, 6)
+	if err != nil {
+		t.Fatalf("RenderText: err %v", err)
+	}
+	if _, err = GenerateProgram(&target, DefaultCrtGeometry.SpriteWidth); err == nil {
+		t.Fatalf("GenerateProgram must fail when the first pixels are dark")
+	}
+}
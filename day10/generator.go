@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+)
+
+type generatorState struct {
+	cost int
+	next int
+}
+
+func GenerateProgram(target *Bitmap, spriteWidth int) (program []Instruction, err error) {
+	geom := CrtGeometry{target.Width(), target.Height(), spriteWidth}
+	width := geom.Width
+	cycles := geom.Pixels()
+
+	// Any X outside of [minX, maxX] leaves the whole row dark, so there is
+	// no point in considering other values.
+	minX, maxX := -1, width
+	for geom.SpriteLeft(minX)+spriteWidth > 0 {
+		minX--
+	}
+	for geom.SpriteLeft(maxX) < width {
+		maxX++
+	}
+	xcount := maxX - minX + 1
+	allowed := func(cycle, x int) bool {
+		pos := cycle % width
+		return geom.ShouldBeLit(pos, x) == target.At(pos, cycle/width)
+	}
+
+	const infinity = 1 << 30
+	best := make([][]generatorState, cycles+1)
+	for c := range best {
+		best[c] = make([]generatorState, xcount)
+		for i := range best[c] {
+			if c < cycles {
+				best[c][i].cost = infinity
+			}
+		}
+	}
+
+	for c := cycles - 1; c >= 0; c-- {
+		for i := 0; i < xcount; i++ {
+			x := minX + i
+			if !allowed(c, x) {
+				continue
+			}
+			state := &best[c][i]
+			if c+2 <= cycles && allowed(c+1, x) {
+				for j := 0; j < xcount; j++ {
+					if best[c+2][j].cost+1 < state.cost {
+						*state = generatorState{best[c+2][j].cost + 1, j}
+					}
+				}
+			}
+			if best[c+1][i].cost+1 < state.cost {
+				*state = generatorState{best[c+1][i].cost + 1, -1}
+			}
+		}
+	}
+
+	i := 1 - minX
+	if best[0][i].cost >= infinity {
+		c := firstUnreachablePixel(cycles, xcount, minX, allowed)
+		err = fmt.Errorf("bitmap cannot be drawn: no way to reach pixel (%d,%d)", c%width, c/width)
+		if c < 2 {
+			err = fmt.Errorf("%v (X starts at 1, so the first two pixels are always lit)", err)
+		}
+		return
+	}
+
+	for c := 0; c < cycles; {
+		state := best[c][i]
+		if state.next < 0 {
+			program = append(program, Instruction{Type: InstrNoop})
+			c++
+		} else {
+			program = append(program, Instruction{Type: InstrAddx, Src: Operand{Value: state.next - i}})
+			i = state.next
+			c += 2
+		}
+	}
+	return
+}
+
+func firstUnreachablePixel(cycles, xcount, minX int, allowed func(cycle, x int) bool) (cycle int) {
+	reach := make([][]bool, cycles+2)
+	for c := range reach {
+		reach[c] = make([]bool, xcount)
+	}
+	reach[0][1-minX] = true
+
+	for cycle = 0; cycle < cycles; cycle++ {
+		found := false
+		for i := 0; i < xcount; i++ {
+			if !reach[cycle][i] || !allowed(cycle, minX+i) {
+				continue
+			}
+			found = true
+			reach[cycle+1][i] = true
+			if allowed(cycle+1, minX+i) {
+				for j := range reach[cycle+2] {
+					reach[cycle+2][j] = true
+				}
+			}
+		}
+		if !found {
+			return
+		}
+	}
+	return
+}
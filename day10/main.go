@@ -2,195 +2,162 @@ package main
 
 import (
 	"bufio"
+	"flag"
 	"fmt"
 	"os"
-	"strconv"
 	"strings"
 )
 
-type InstructionType int
-
-const (
-	InstrNoop InstructionType = iota
-	InstrAddx
-)
-
-type Instruction struct {
-	Type  InstructionType
-	Value int
+type Options struct {
+	Geometry CrtGeometry
+	Image    string
+	Frames   bool
 }
 
-type CpuState int
-
-const (
-	CSReady CpuState = iota
-	CSAdding
-)
-
-type Cpu struct {
-	cycle   int
-	regX    int
-	program []Instruction
-	state   CpuState
-	buffer  int
-}
+func mode1(cpu *Cpu) {
+	const first = 20
+	const interval = 40
 
-const CrtWidth = 40
+	sigStrSum := 0
 
-type Crt struct {
-	pos    int
-	silent bool
-}
+	for cpu.NextCycle() {
+		if cpu.Cycle() < first {
+			continue
+		}
 
-func MakeCpu(program []Instruction) (result Cpu) {
-	result.cycle = 1
-	result.regX = 1
-	result.program = program
-	return
+		if (cpu.Cycle()-first)%interval == 0 {
+			sigStrSum += cpu.Cycle() * cpu.X()
+		}
+	}
+	fmt.Println(sigStrSum)
 }
 
-func (cpu *Cpu) Cycle() int {
-	return cpu.cycle
+func RunCrt(cpu *Cpu, crt *Crt) {
+	for {
+		crt.Draw(crt.ShouldBeLit(cpu.X()))
+		if !cpu.NextCycle() {
+			break
+		}
+	}
 }
 
-func (cpu *Cpu) X() int {
-	return cpu.regX
+func (opts *Options) MakeCrt(silent bool) (result Crt) {
+	result = MakeCrt(opts.Geometry, silent)
+	if opts.Frames {
+		result.KeepFrames()
+	}
+	return
 }
 
-func (cpu *Cpu) NextCycle() bool {
-	if len(cpu.program) == 0 {
-		return false
+func (opts *Options) SaveImages(crt *Crt) {
+	if opts.Image == "" {
+		return
 	}
-
-	cpu.cycle++
-
-	switch cpu.state {
-	case CSReady:
-		nextInstruction := cpu.program[0]
-		cpu.program = cpu.program[1:]
-
-		switch nextInstruction.Type {
-		case InstrNoop:
-		case InstrAddx:
-			cpu.state = CSAdding
-			cpu.buffer = nextInstruction.Value
+	frames := crt.Frames()
+	for i := range frames {
+		path := opts.Image
+		if opts.Frames {
+			path = FramePath(path, i)
+		}
+		if err := SaveImage(&frames[i], path); err != nil {
+			panic(err)
 		}
-	case CSAdding:
-		cpu.regX += cpu.buffer
-		cpu.state = CSReady
 	}
-
-	return true
 }
 
-func MakeCrt(silent bool) (result Crt) {
-	result.silent = silent
-	return
+func mode2(cpu *Cpu, opts *Options) {
+	crt := opts.MakeCrt(false)
+	RunCrt(cpu, &crt)
+	opts.SaveImages(&crt)
 }
 
-func (crt *Crt) Pos() int {
-	return crt.pos
+func modeOcr(cpu *Cpu, opts *Options) {
+	crt := opts.MakeCrt(true)
+	RunCrt(cpu, &crt)
+	frames := crt.Frames()
+	for i := range frames {
+		fmt.Println(DecodeText(&frames[i]))
+	}
+	opts.SaveImages(&crt)
 }
 
-func (crt *Crt) Draw(lit bool) {
-	c := '.'
-	if lit {
-		c = '#'
+func modeGenerate(scanner *bufio.Scanner, opts *Options) {
+	geom := opts.Geometry
+	var target Bitmap
+	var err error
+	if flag.NArg() > 1 {
+		target, err = RenderText(strings.Join(flag.Args()[1:], " "), geom.Width, geom.Height)
+	} else {
+		target, err = ParseBitmap(scanner)
+		if err == nil && (target.Width() != geom.Width || target.Height() != geom.Height) {
+			err = fmt.Errorf("%dx%d bitmap expected", geom.Width, geom.Height)
+		}
 	}
-	if !crt.silent {
-		fmt.Printf("%c", c)
+	if err != nil {
+		panic(err)
 	}
-	crt.pos++
-	if crt.pos == CrtWidth {
-		if !crt.silent {
-			fmt.Println()
-		}
-		crt.pos = 0
+
+	program, err := GenerateProgram(&target, geom.SpriteWidth)
+	if err != nil {
+		panic(err)
+	}
+	for _, instr := range program {
+		fmt.Println(instr)
 	}
 }
 
-func ParseInstruction(str string) (result Instruction) {
-	if str == "noop" {
-		result.Type = InstrNoop
-		return
+func main() {
+	opts := Options{Geometry: DefaultCrtGeometry}
+	flag.IntVar(&opts.Geometry.Width, "width", opts.Geometry.Width, "CRT width in pixels")
+	flag.IntVar(&opts.Geometry.Height, "height", opts.Geometry.Height, "CRT height in pixels")
+	flag.IntVar(&opts.Geometry.SpriteWidth, "sprite", opts.Geometry.SpriteWidth, "sprite width in pixels")
+	flag.StringVar(&opts.Image, "image", "", "save the screen to a .pbm or .png file")
+	flag.BoolVar(&opts.Frames, "frames", false, "keep a separate frame for every screen the program draws")
+	flag.Parse()
+
+	mode := "1"
+	if flag.NArg() > 0 {
+		mode = flag.Arg(0)
 	}
 
-	fields := strings.Fields(str)
-	if fields[0] == "addx" {
-		result.Type = InstrAddx
-		if len(fields) != 2 {
-			panic("addx: exactly 1 argument expected")
+	input := os.Stdin
+	if mode == "debug" {
+		if flag.NArg() < 2 {
+			panic("Program file expected")
 		}
 		var err error
-		result.Value, err = strconv.Atoi(fields[1])
+		input, err = os.Open(flag.Arg(1))
 		if err != nil {
 			panic(err)
 		}
-	} else {
-		panic("Invalid instruction")
 	}
 
-	return
-}
-
-func mode1(cpu *Cpu) {
-	const first = 20
-	const interval = 40
-
-	sigStrSum := 0
-
-	for cpu.NextCycle() {
-		if cpu.Cycle() < first {
-			continue
-		}
-
-		if (cpu.Cycle()-first)%interval == 0 {
-			sigStrSum += cpu.Cycle() * cpu.X()
-			//fmt.Printf("%d: %d\n", cpu.Cycle(), cpu.X())
-		}
-	}
-	fmt.Println(sigStrSum)
-}
-
-func Abs(val int) int {
-	if val >= 0 {
-		return val
-	}
-	return -val
-}
-
-func ShouldBeLit(curRow, center int) bool {
-	return Abs(curRow-center) <= 1
-}
-
-func mode2(cpu *Cpu) {
-	crt := MakeCrt(false)
-	for {
-		lit := ShouldBeLit(crt.Pos(), cpu.X())
-		//fmt.Printf("Cycle %d: pos=%d, X=%d, lit=%v\n", cpu.Cycle(), crt.Pos(), cpu.X(), lit)
-		crt.Draw(lit)
-		if !cpu.NextCycle() {
-			break
-		}
+	scanner := bufio.NewScanner(input)
+	if mode == "gen" {
+		modeGenerate(scanner, &opts)
+		return
 	}
-}
-
-func main() {
-	scanner := bufio.NewScanner(os.Stdin)
-	program := []Instruction{}
 
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line != "" {
-			program = append(program, ParseInstruction(line))
-		}
+	program, err := Assemble(scanner)
+	if err != nil {
+		panic(err)
 	}
 
 	cpu := MakeCpu(program)
 
-	if (len(os.Args) > 1) && (os.Args[1] == "2") {
-		mode2(&cpu)
-	} else {
+	switch mode {
+	case "2":
+		mode2(&cpu, &opts)
+	case "ocr":
+		modeOcr(&cpu, &opts)
+	case "trace":
+		out := bufio.NewWriter(os.Stdout)
+		Trace(&cpu, opts.Geometry, out)
+		out.Flush()
+	case "debug":
+		debugger := NewDebugger(&cpu, opts.Geometry, bufio.NewScanner(os.Stdin), os.Stdout)
+		debugger.Run()
+	default:
 		mode1(&cpu)
 	}
 }
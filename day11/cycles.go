@@ -0,0 +1,105 @@
+package main
+
+type ItemState struct {
+	Monkey int
+	Worry  WorryLevel
+}
+
+// ItemCycle describes the trajectory of a single item from round to round.
+// Items never interact, so once worry levels are reduced modulo the worry
+// modulus the state at the start of a round determines everything that
+// follows, and every item eventually enters a cycle.
+type ItemCycle struct {
+	prefix        [][]uint64
+	start, length int
+}
+
+// RoundStep moves a single item through one round and counts the
+// inspections it causes, indexed by the position of the monkey in
+// MonkeyIds.
+func RoundStep(group *MonkeyGroup, state ItemState, counts []uint64) ItemState {
+	for i, num := range group.MonkeyIds() {
+		if state.Monkey != num {
+			continue
+		}
+		monkey := group.Monkey(num)
+		state.Worry = monkey.Operation(state.Worry)
+		target := monkey.Test(state.Worry)
+		if target == num {
+			panic("Can't throw an item to itself")
+		}
+		counts[i]++
+		state.Monkey = target
+	}
+	return state
+}
+
+func FindItemCycle(group *MonkeyGroup, state ItemState) (result ItemCycle) {
+	seen := make(map[ItemState]int)
+	result.prefix = [][]uint64{make([]uint64, group.NumMonkeys())}
+	for round := 0; ; round++ {
+		if first, ok := seen[state]; ok {
+			result.start = first
+			result.length = round - first
+			return
+		}
+		seen[state] = round
+
+		counts := append([]uint64(nil), result.prefix[round]...)
+		state = RoundStep(group, state, counts)
+		result.prefix = append(result.prefix, counts)
+	}
+}
+
+// InspectCounts returns how many times each monkey inspects the item during
+// the given number of rounds, indexed like the counts of RoundStep.
+func (cycle *ItemCycle) InspectCounts(rounds uint64) []uint64 {
+	if rounds < uint64(len(cycle.prefix)) {
+		return cycle.prefix[rounds]
+	}
+
+	start, end := cycle.prefix[cycle.start], cycle.prefix[cycle.start+cycle.length]
+	full := (rounds - uint64(cycle.start)) / uint64(cycle.length)
+	rem := cycle.prefix[cycle.start+int((rounds-uint64(cycle.start))%uint64(cycle.length))]
+
+	result := make([]uint64, len(start))
+	for i := range result {
+		perCycle := CheckedMul(WorryLevel(end[i]-start[i]), WorryLevel(full), 0)
+		result[i] = uint64(CheckedAdd(perCycle, WorryLevel(rem[i]), 0))
+	}
+	return result
+}
+
+// SimulateCycles adds the inspection counts of the given number of rounds to
+// every monkey without simulating the rounds one by one. It requires modular
+// worry levels and no relief.
+func SimulateCycles(group *MonkeyGroup, rounds uint64) {
+	if group.modulus == 0 {
+		panic("Cycle detection requires modular worry levels")
+	}
+
+	cycles := make(map[ItemState]*ItemCycle)
+	ids := group.MonkeyIds()
+	for _, num := range ids {
+		monkey := group.Monkey(num)
+		for _, item := range monkey.Items {
+			state := ItemState{num, item % group.modulus}
+			cycle, ok := cycles[state]
+			if !ok {
+				found := FindItemCycle(group, state)
+				cycle = &found
+				cycles[state] = cycle
+			}
+			for j, count := range cycle.InspectCounts(rounds) {
+				m := group.Monkey(ids[j])
+				m.InspectCount = uint64(CheckedAdd(WorryLevel(m.InspectCount), WorryLevel(count), 0))
+			}
+		}
+	}
+
+	// The final positions of the items are not tracked, so they are dropped
+	// rather than left in a misleading place.
+	for _, num := range ids {
+		group.Monkey(num).Items = nil
+	}
+}
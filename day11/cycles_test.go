@@ -0,0 +1,32 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"testing"
+)
+
+func LoadTestGroup(t *testing.T) *MonkeyGroup {
+	f, err := os.Open("test_input")
+	if err != nil {
+		t.Fatalf("LoadTestGroup: %v", err)
+	}
+	defer f.Close()
+	return ParseMonkeyGroup(bufio.NewScanner(f))
+}
+
+func TestCycles(t *testing.T) {
+	for _, rounds := range []uint64{0, 1, 2, 20, 137, 1000} {
+		direct, cycles := LoadTestGroup(t), LoadTestGroup(t)
+		for i := uint64(0); i < rounds; i++ {
+			Round(direct, NoRelief)
+		}
+		SimulateCycles(cycles, rounds)
+		for _, i := range direct.MonkeyIds() {
+			expected, got := direct.Monkey(i).InspectCount, cycles.Monkey(i).InspectCount
+			if expected != got {
+				t.Fatalf("TestCycles: %d rounds, monkey %d: expected %d, got %d", rounds, i, expected, got)
+			}
+		}
+	}
+}
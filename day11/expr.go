@@ -0,0 +1,330 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"math/bits"
+	"strconv"
+	"strings"
+)
+
+type ExprKind int
+
+const (
+	ExprLiteral ExprKind = iota
+	ExprOld
+	ExprBinary
+)
+
+type Expr struct {
+	Kind     ExprKind
+	Op       byte
+	Value    int64
+	Lhs, Rhs *Expr
+}
+
+type ModularEval func(old, modulus WorryLevel) WorryLevel
+
+type exprParser struct {
+	src string
+	pos int
+}
+
+func ParseExpression(src string) (result *Expr, err error) {
+	parser := exprParser{src: src}
+	result, err = parser.parseSum()
+	if err == nil && parser.peek() != 0 {
+		err = parser.errorf("unexpected %q", parser.peek())
+	}
+	return
+}
+
+func (parser *exprParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("column %d: %s", parser.pos+1, fmt.Sprintf(format, args...))
+}
+
+func (parser *exprParser) peek() byte {
+	for parser.pos < len(parser.src) && parser.src[parser.pos] == ' ' {
+		parser.pos++
+	}
+	if parser.pos == len(parser.src) {
+		return 0
+	}
+	return parser.src[parser.pos]
+}
+
+func (parser *exprParser) parseSum() (*Expr, error) {
+	lhs, err := parser.parseProduct()
+	for err == nil {
+		op := parser.peek()
+		if op != '+' && op != '-' {
+			break
+		}
+		parser.pos++
+		var rhs *Expr
+		rhs, err = parser.parseProduct()
+		if err == nil {
+			lhs, err = MakeBinaryExpr(op, lhs, rhs)
+		}
+	}
+	return lhs, err
+}
+
+func (parser *exprParser) parseProduct() (*Expr, error) {
+	lhs, err := parser.parseFactor()
+	for err == nil {
+		op := parser.peek()
+		if op != '*' && op != '/' && op != '%' {
+			break
+		}
+		start := parser.pos
+		parser.pos++
+		var rhs *Expr
+		rhs, err = parser.parseFactor()
+		if err == nil {
+			lhs, err = MakeBinaryExpr(op, lhs, rhs)
+			if err != nil {
+				parser.pos = start
+				err = parser.errorf("%v", err)
+			}
+		}
+	}
+	return lhs, err
+}
+
+func (parser *exprParser) parseFactor() (*Expr, error) {
+	c := parser.peek()
+	switch {
+	case c == '(':
+		parser.pos++
+		inner, err := parser.parseSum()
+		if err != nil {
+			return nil, err
+		}
+		if parser.peek() != ')' {
+			return nil, parser.errorf("')' expected")
+		}
+		parser.pos++
+		return inner, nil
+	case c == '-':
+		parser.pos++
+		inner, err := parser.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+		return MakeBinaryExpr('-', &Expr{Kind: ExprLiteral}, inner)
+	case c >= '0' && c <= '9':
+		start := parser.pos
+		for parser.pos < len(parser.src) && parser.src[parser.pos] >= '0' && parser.src[parser.pos] <= '9' {
+			parser.pos++
+		}
+		value, err := strconv.ParseInt(parser.src[start:parser.pos], 10, 64)
+		if err != nil {
+			parser.pos = start
+			return nil, parser.errorf("invalid literal")
+		}
+		return &Expr{Kind: ExprLiteral, Value: value}, nil
+	case strings.HasPrefix(parser.src[parser.pos:], "old"):
+		parser.pos += len("old")
+		return &Expr{Kind: ExprOld}, nil
+	case c == 0:
+		return nil, parser.errorf("unexpected end of expression")
+	}
+	return nil, parser.errorf("unexpected %q", c)
+}
+
+func MakeBinaryExpr(op byte, lhs, rhs *Expr) (*Expr, error) {
+	if !lhs.HasOld() && !rhs.HasOld() {
+		value, err := foldConstant(op, lhs.Value, rhs.Value)
+		return &Expr{Kind: ExprLiteral, Value: value}, err
+	}
+
+	switch op {
+	case '/':
+		return nil, errors.New("division of a value depending on old breaks modular worry levels")
+	case '%':
+		if rhs.HasOld() {
+			return nil, errors.New("modulo by a value depending on old breaks modular worry levels")
+		}
+		if rhs.Value <= 0 {
+			return nil, errors.New("modulo by a non-positive value")
+		}
+	}
+	return &Expr{Kind: ExprBinary, Op: op, Lhs: lhs, Rhs: rhs}, nil
+}
+
+// foldConstant evaluates an operation on two literals exactly and fails if
+// the result does not fit into a literal.
+func foldConstant(op byte, lhs, rhs int64) (int64, error) {
+	x, y := big.NewInt(lhs), big.NewInt(rhs)
+	result := new(big.Int)
+	switch op {
+	case '+':
+		result.Add(x, y)
+	case '-':
+		result.Sub(x, y)
+	case '*':
+		result.Mul(x, y)
+	case '/', '%':
+		if rhs == 0 {
+			return 0, errors.New("division by zero")
+		}
+		if op == '/' {
+			result.Quo(x, y)
+		} else {
+			result.Rem(x, y)
+		}
+	default:
+		panic("Invalid operator")
+	}
+	if !result.IsInt64() {
+		return 0, fmt.Errorf("constant overflow: %d %c %d does not fit in 64 bits", lhs, op, rhs)
+	}
+	return result.Int64(), nil
+}
+
+func (expr *Expr) HasOld() bool {
+	switch expr.Kind {
+	case ExprOld:
+		return true
+	case ExprBinary:
+		return expr.Lhs.HasOld() || expr.Rhs.HasOld()
+	}
+	return false
+}
+
+// ModDivisors lists the divisors of % operations applied to values that
+// depend on old. Such an operation is only compatible with the modulus trick
+// if the divisor divides the worry modulus.
+func (expr *Expr) ModDivisors() (result []WorryLevel) {
+	if expr.Kind != ExprBinary {
+		return
+	}
+	if expr.Op == '%' {
+		result = append(result, WorryLevel(expr.Rhs.Value))
+	}
+	result = append(result, expr.Lhs.ModDivisors()...)
+	result = append(result, expr.Rhs.ModDivisors()...)
+	return
+}
+
+func (expr *Expr) String() string {
+	switch expr.Kind {
+	case ExprLiteral:
+		return strconv.FormatInt(expr.Value, 10)
+	case ExprOld:
+		return "old"
+	}
+	return fmt.Sprintf("(%v %c %v)", expr.Lhs, expr.Op, expr.Rhs)
+}
+
+func CheckedAdd(lhs, rhs, modulus WorryLevel) WorryLevel {
+	sum, carry := bits.Add64(uint64(lhs), uint64(rhs), 0)
+	if modulus != 0 {
+		return WorryLevel(bits.Rem64(carry, sum, uint64(modulus)))
+	}
+	if carry != 0 {
+		panic(fmt.Sprintf("Worry level overflow: %d + %d does not fit in 64 bits", lhs, rhs))
+	}
+	return WorryLevel(sum)
+}
+
+func CheckedSub(lhs, rhs, modulus WorryLevel) WorryLevel {
+	if modulus != 0 {
+		return CheckedAdd(lhs, modulus-rhs%modulus, modulus)
+	}
+	if rhs > lhs {
+		panic(fmt.Sprintf("Worry level underflow: %d - %d is negative", lhs, rhs))
+	}
+	return lhs - rhs
+}
+
+func CheckedMul(lhs, rhs, modulus WorryLevel) WorryLevel {
+	hi, lo := bits.Mul64(uint64(lhs), uint64(rhs))
+	if modulus != 0 {
+		return WorryLevel(bits.Rem64(hi, lo, uint64(modulus)))
+	}
+	if hi != 0 {
+		panic(fmt.Sprintf("Worry level overflow: %d * %d does not fit in 64 bits", lhs, rhs))
+	}
+	return WorryLevel(lo)
+}
+
+func reduce(value, modulus WorryLevel) WorryLevel {
+	if modulus != 0 {
+		return value % modulus
+	}
+	return value
+}
+
+func reduceLiteral(value int64, modulus WorryLevel) WorryLevel {
+	if value >= 0 {
+		return reduce(WorryLevel(value), modulus)
+	}
+	if modulus == 0 {
+		panic(fmt.Sprintf("Worry level underflow: literal %d is negative", value))
+	}
+	return (modulus - WorryLevel(-value)%modulus) % modulus
+}
+
+// CompileModular builds an evaluator that keeps every intermediate result
+// reduced modulo the given modulus. A zero modulus means exact arithmetic,
+// which panics on overflow or on a negative result.
+func (expr *Expr) CompileModular() ModularEval {
+	switch expr.Kind {
+	case ExprLiteral:
+		value := expr.Value
+		return func(old, modulus WorryLevel) WorryLevel {
+			return reduceLiteral(value, modulus)
+		}
+	case ExprOld:
+		return func(old, modulus WorryLevel) WorryLevel {
+			return reduce(old, modulus)
+		}
+	}
+
+	lhs, rhs := expr.Lhs.CompileModular(), expr.Rhs.CompileModular()
+	switch expr.Op {
+	case '+':
+		return func(old, modulus WorryLevel) WorryLevel {
+			return CheckedAdd(lhs(old, modulus), rhs(old, modulus), modulus)
+		}
+	case '-':
+		return func(old, modulus WorryLevel) WorryLevel {
+			return CheckedSub(lhs(old, modulus), rhs(old, modulus), modulus)
+		}
+	case '*':
+		return func(old, modulus WorryLevel) WorryLevel {
+			return CheckedMul(lhs(old, modulus), rhs(old, modulus), modulus)
+		}
+	case '%':
+		divisor := WorryLevel(expr.Rhs.Value)
+		return func(old, modulus WorryLevel) WorryLevel {
+			return lhs(old, modulus) % divisor
+		}
+	}
+	panic("Invalid operator")
+}
+
+func (expr *Expr) EvalBig(old *big.Int) *big.Int {
+	switch expr.Kind {
+	case ExprLiteral:
+		return big.NewInt(expr.Value)
+	case ExprOld:
+		return new(big.Int).Set(old)
+	}
+
+	lhs, rhs := expr.Lhs.EvalBig(old), expr.Rhs.EvalBig(old)
+	switch expr.Op {
+	case '+':
+		return lhs.Add(lhs, rhs)
+	case '-':
+		return lhs.Sub(lhs, rhs)
+	case '*':
+		return lhs.Mul(lhs, rhs)
+	case '%':
+		return lhs.Mod(lhs, rhs)
+	}
+	panic("Invalid operator")
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func AssertEval(t *testing.T, src string, old, modulus, expected WorryLevel) {
+	expr, err := ParseExpression(src)
+	if err != nil {
+		t.Fatalf("AssertEval(t, %q, %d, %d, %d): err %v", src, old, modulus, expected, err)
+	}
+	got := expr.CompileModular()(old, modulus)
+	if got != expected {
+		t.Fatalf("AssertEval(t, %q, %d, %d, %d): got %d", src, old, modulus, expected, got)
+	}
+}
+
+func AssertParseErr(t *testing.T, src string, expected string) {
+	_, err := ParseExpression(src)
+	if err == nil {
+		t.Fatalf("AssertParseErr(t, %q, %q): no error", src, expected)
+	}
+	if !strings.Contains(err.Error(), expected) {
+		t.Fatalf("AssertParseErr(t, %q, %q): got %v instead", src, expected, err)
+	}
+}
+
+func TestEval(t *testing.T) {
+	AssertEval(t, "old * 19", 79, 1000000, 1501)
+	AssertEval(t, "old * old", 79, 1000000, 6241)
+	AssertEval(t, "old+3", 79, 1000000, 82)
+	AssertEval(t, "(old * 3 + 7) * old", 5, 1000000, 110)
+	AssertEval(t, "(old * 3 + 7) * old", 5, 7, 110%7)
+	AssertEval(t, "old - 10", 3, 96577, 96570)
+	AssertEval(t, "-old + (20 / 3) * 2", 5, 1000, 7)
+	AssertEval(t, "old % 4 + old", 10, 96, 12)
+}
+
+func TestParseErrors(t *testing.T) {
+	AssertParseErr(t, "old / 3", "column 5: division of a value depending on old")
+	AssertParseErr(t, "3 % old", "modulo by a value depending on old")
+	AssertParseErr(t, "(old + 1", "column 9: ')' expected")
+	AssertParseErr(t, "old ^ 2", "column 5: unexpected '^'")
+	AssertParseErr(t, "old *", "unexpected end of expression")
+	AssertParseErr(t, "old + 1 / 0", "division by zero")
+	AssertParseErr(t, "old * (4611686018427387904 * 4)", "constant overflow")
+	AssertParseErr(t, "old + (0 - 9223372036854775807 - 2)", "constant overflow")
+}
+
+func TestOverflow(t *testing.T) {
+	AssertEval(t, "old * old", 1<<32-1, 0, (1<<32-1)*(1<<32-1))
+	AssertEval(t, "old * old", 1<<40, 1<<20+7, 2401)
+	AssertEval(t, "old * old", 1<<40-3, 1<<40+15, 324)
+	AssertEval(t, "old + old", 1<<63, 1<<63+5, 1<<63-5)
+
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("TestOverflow: no panic on 64 bit overflow")
+		}
+	}()
+	AssertEval(t, "old * old", 1<<32, 0, 0)
+}
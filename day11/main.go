@@ -2,27 +2,46 @@ package main
 
 import (
 	"bufio"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
+	"math/big"
 	"os"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 )
 
 type WorryLevel uint64
+
+const NoRelief WorryLevel = 1
+
 type MonkeyOp func(WorryLevel) WorryLevel
 type MonkeyTest func(WorryLevel) int
+type TestRule struct {
+	DivBy           WorryLevel
+	IfTrue, IfFalse int
+}
+
 type Monkey struct {
 	Items        []WorryLevel
 	Operation    MonkeyOp
 	Test         MonkeyTest
+	Expression   *Expr
+	Rule         TestRule
 	InspectCount uint64
+	Throws       map[int]uint64
 }
 
 type MonkeyGroup struct {
 	monkeys      map[int]*Monkey
 	maxMonkey    int
+	ids          []int
 	worryModulus WorryLevel
+	modulus      WorryLevel
+	narrator     *Narrator
 }
 
 type MonkeyParser struct {
@@ -33,13 +52,15 @@ type MonkeyParser struct {
 	ifTestTrue    *regexp.Regexp
 	ifTestFalse   *regexp.Regexp
 
-	opBinary    *regexp.Regexp
 	testDivBy   *regexp.Regexp
 	throwAction *regexp.Regexp
+
+	modDivisors []WorryLevel
 }
 
 type TopSelector struct {
-	first, second uint64
+	size int
+	top  []uint64
 }
 
 func (monkey *Monkey) AppendItem(item WorryLevel) {
@@ -59,6 +80,10 @@ func (group *MonkeyGroup) AddMonkey(num int, monkey *Monkey) {
 		panic("Monkey already exists")
 	}
 	group.monkeys[num] = monkey
+	pos := sort.SearchInts(group.ids, num)
+	group.ids = append(group.ids, 0)
+	copy(group.ids[pos+1:], group.ids[pos:])
+	group.ids[pos] = num
 	if group.maxMonkey < num {
 		group.maxMonkey = num
 	}
@@ -76,6 +101,27 @@ func (group *MonkeyGroup) NumMonkeys() int {
 	return len(group.monkeys)
 }
 
+// MonkeyIds lists the monkey numbers in the order the monkeys take turns.
+func (group *MonkeyGroup) MonkeyIds() []int {
+	return group.ids
+}
+
+func (group *MonkeyGroup) WorryModulus() WorryLevel {
+	return group.worryModulus
+}
+
+func (group *MonkeyGroup) SetNarrator(narrator *Narrator) {
+	group.narrator = narrator
+}
+
+func (group *MonkeyGroup) UseModulus(enabled bool) {
+	if enabled {
+		group.modulus = group.worryModulus
+	} else {
+		group.modulus = 0
+	}
+}
+
 func MakeMonkeyParser() (result MonkeyParser) {
 	result.header = regexp.MustCompile(`^Monkey (\d+):$`)
 	result.startingItems = regexp.MustCompile(`^  Starting items:\s*(\d+(?:,\s*\d+)*)$`)
@@ -84,7 +130,6 @@ func MakeMonkeyParser() (result MonkeyParser) {
 	result.ifTestTrue = regexp.MustCompile(`^    If true:\s*(.*)$`)
 	result.ifTestFalse = regexp.MustCompile(`^    If false:\s(.*)$`)
 
-	result.opBinary = regexp.MustCompile(`^((?:old)|(?:\d+))\s*([+*])\s*((?:old)|(?:\d+))$`)
 	result.testDivBy = regexp.MustCompile(`^divisible by (\d+)$`)
 	result.throwAction = regexp.MustCompile(`^throw to monkey (\d+)$`)
 	return
@@ -105,57 +150,17 @@ func (parser *MonkeyParser) ParseStartingItems(str string) []WorryLevel {
 	return result
 }
 
-func (parser *MonkeyParser) ParseOperation(str string, worryModulus *WorryLevel) MonkeyOp {
-	matches := parser.opBinary.FindStringSubmatch(str)
-	if len(matches) != 4 {
-		panic("Invalid operation")
-	}
-
-	parseArg := func(s string) (useOld bool, literal WorryLevel) {
-		if s == "old" {
-			useOld = true
-			return
-		}
-
-		useOld = false
-		val, err := strconv.Atoi(s)
-		if err != nil {
-			panic("Invalid operation argument")
-		}
-
-		literal = WorryLevel(val)
-
-		return
-	}
-
-	lhsOld, lhsLit := parseArg(matches[1])
-	rhsOld, rhsLit := parseArg(matches[3])
-	var op func(WorryLevel, WorryLevel) WorryLevel
-	switch matches[2] {
-	case "+":
-		op = func(lhs, rhs WorryLevel) WorryLevel { return lhs + rhs }
-	case "*":
-		op = func(lhs, rhs WorryLevel) WorryLevel { return lhs * rhs }
-	default:
-		panic("Invalid operation sign")
+func (parser *MonkeyParser) ParseOperation(str string, modulus *WorryLevel) (MonkeyOp, *Expr) {
+	expr, err := ParseExpression(str)
+	if err != nil {
+		panic(fmt.Sprintf("Invalid operation %q: %v", str, err))
 	}
+	parser.modDivisors = append(parser.modDivisors, expr.ModDivisors()...)
 
+	eval := expr.CompileModular()
 	return func(old WorryLevel) WorryLevel {
-		var lhs, rhs WorryLevel
-		if lhsOld {
-			lhs = old
-		} else {
-			lhs = lhsLit
-		}
-
-		if rhsOld {
-			rhs = old
-		} else {
-			rhs = rhsLit
-		}
-
-		return op(lhs, rhs) % *worryModulus
-	}
+		return eval(old, *modulus)
+	}, expr
 }
 
 func (parser *MonkeyParser) ParseThrowAction(str string) (result int) {
@@ -173,32 +178,31 @@ func (parser *MonkeyParser) ParseThrowAction(str string) (result int) {
 	return
 }
 
-func (parser *MonkeyParser) ParseTest(test, ifTrue, ifFalse string, worryModulus *WorryLevel) MonkeyTest {
+func (parser *MonkeyParser) ParseTest(test, ifTrue, ifFalse string, worryModulus *WorryLevel) (MonkeyTest, TestRule) {
 	matches := parser.testDivBy.FindStringSubmatch(test)
 	if len(matches) != 2 {
 		panic("Invalid test")
 	}
 
 	divBy, err := strconv.Atoi(matches[1])
-	if err != nil {
+	if err != nil || divBy <= 0 {
 		panic("Invalid test expression")
 	}
 
-	*worryModulus *= WorryLevel(divBy)
+	*worryModulus = CheckedMul(*worryModulus, WorryLevel(divBy), 0)
 
-	trueTarget := parser.ParseThrowAction(ifTrue)
-	falseTarget := parser.ParseThrowAction(ifFalse)
+	rule := TestRule{WorryLevel(divBy), parser.ParseThrowAction(ifTrue), parser.ParseThrowAction(ifFalse)}
 
 	return func(level WorryLevel) int {
-		if level%WorryLevel(divBy) == 0 {
-			return trueTarget
+		if level%rule.DivBy == 0 {
+			return rule.IfTrue
 		} else {
-			return falseTarget
+			return rule.IfFalse
 		}
-	}
+	}, rule
 }
 
-func (parser *MonkeyParser) ParseMonkey(scanner *bufio.Scanner, worryModulus *WorryLevel) (success bool, num int, result Monkey) {
+func (parser *MonkeyParser) ParseMonkey(scanner *bufio.Scanner, group *MonkeyGroup) (success bool, num int, result Monkey) {
 	parseLine := func(line string, regex *regexp.Regexp) (bool, []string) {
 		matches := regex.FindStringSubmatch(line)
 		if len(matches) != regex.NumSubexp()+1 {
@@ -244,12 +248,13 @@ func (parser *MonkeyParser) ParseMonkey(scanner *bufio.Scanner, worryModulus *Wo
 		panic("Invalid starting items")
 	}
 	result.Items = parser.ParseStartingItems(matches[1])
+	result.Throws = make(map[int]uint64)
 
 	ok, matches = getLine(parser.operation)
 	if !ok {
 		panic("Invalid operation")
 	}
-	result.Operation = parser.ParseOperation(matches[1], worryModulus)
+	result.Operation, result.Expression = parser.ParseOperation(matches[1], &group.modulus)
 
 	ok, matches = getLine(parser.test)
 	if !ok {
@@ -269,7 +274,7 @@ func (parser *MonkeyParser) ParseMonkey(scanner *bufio.Scanner, worryModulus *Wo
 	}
 	ifTestFalse := matches[1]
 
-	result.Test = parser.ParseTest(test, ifTestTrue, ifTestFalse, worryModulus)
+	result.Test, result.Rule = parser.ParseTest(test, ifTestTrue, ifTestFalse, &group.worryModulus)
 
 	success = true
 	return
@@ -280,7 +285,7 @@ func ParseMonkeyGroup(scanner *bufio.Scanner) (result *MonkeyGroup) {
 	result = NewMonkeyGroup()
 
 	for {
-		success, num, monkey := parser.ParseMonkey(scanner, &result.worryModulus)
+		success, num, monkey := parser.ParseMonkey(scanner, result)
 		if !success {
 			break
 		}
@@ -291,69 +296,251 @@ func ParseMonkeyGroup(scanner *bufio.Scanner) (result *MonkeyGroup) {
 		panic("Extra lines at the end")
 	}
 
+	for _, num := range result.ids {
+		rule := result.Monkey(num).Rule
+		for _, target := range []int{rule.IfTrue, rule.IfFalse} {
+			if _, ok := result.monkeys[target]; !ok {
+				panic(fmt.Sprintf("Monkey %d throws to missing monkey %d", num, target))
+			}
+		}
+	}
+
+	for _, divisor := range parser.modDivisors {
+		if result.worryModulus%divisor != 0 {
+			panic(fmt.Sprintf("Operation takes worry level modulo %d, which does not divide the worry modulus %d", divisor, result.worryModulus))
+		}
+	}
+	result.UseModulus(true)
+
 	return
 }
 
-func Turn(group *MonkeyGroup, cur int, relief bool) {
+func Turn(group *MonkeyGroup, cur int, relief WorryLevel) {
 	monkey := group.Monkey(cur)
+	narrate := group.narrator.Active()
+	if narrate {
+		group.narrator.BeginTurn(cur)
+	}
 	for _, item := range monkey.Items {
-		wl := monkey.Operation(item)
-		if relief {
-			wl /= 3
-		}
+		inspected := monkey.Operation(item)
+		wl := inspected / relief
 		target := monkey.Test(wl)
 		if target == cur {
 			panic("Can't throw an item to itself")
 		}
-		//fmt.Printf("%d: %d -> %d, target=%d\n", cur, item, wl, target)
+		if narrate {
+			group.narrator.Inspect(monkey, item, inspected, wl, relief, target)
+		}
 		group.Monkey(target).AppendItem(wl)
 		monkey.InspectCount++
+		monkey.Throws[target]++
 	}
 	monkey.Items = monkey.Items[:0]
 }
 
-func Round(group *MonkeyGroup, relief bool) {
-	for i := 0; i < group.NumMonkeys(); i++ {
-		Turn(group, i, relief)
+func Round(group *MonkeyGroup, relief WorryLevel) {
+	for _, num := range group.ids {
+		Turn(group, num, relief)
+	}
+	if group.narrator != nil {
+		group.narrator.EndRound(group)
+	}
+}
+
+func MakeTopSelector(size int) (result TopSelector) {
+	if size <= 0 {
+		panic("Invalid top size")
 	}
+	result.size = size
+	return
 }
 
 func (selector *TopSelector) Insert(val uint64) {
-	if val >= selector.first {
-		selector.second = selector.first
-		selector.first = val
-	} else if val >= selector.second {
-		selector.second = val
+	pos := len(selector.top)
+	for pos > 0 && selector.top[pos-1] < val {
+		pos--
 	}
+	if pos >= selector.size {
+		return
+	}
+	if len(selector.top) < selector.size {
+		selector.top = append(selector.top, 0)
+	}
+	copy(selector.top[pos+1:], selector.top[pos:])
+	selector.top[pos] = val
+}
+
+func (selector *TopSelector) MonkeyBusiness() *big.Int {
+	result := big.NewInt(1)
+	for _, val := range selector.top {
+		result.Mul(result, new(big.Int).SetUint64(val))
+	}
+	return result
+}
+
+func WriteCsvHeader(group *MonkeyGroup, out io.Writer) {
+	fmt.Fprint(out, "round")
+	for _, num := range group.MonkeyIds() {
+		fmt.Fprintf(out, ",monkey %d", num)
+	}
+	fmt.Fprintln(out)
+}
+
+func WriteCsvRow(group *MonkeyGroup, round uint64, out io.Writer) {
+	fmt.Fprint(out, round)
+	for _, num := range group.MonkeyIds() {
+		fmt.Fprintf(out, ",%d", group.Monkey(num).InspectCount)
+	}
+	fmt.Fprintln(out)
+}
+
+func RunRounds(group *MonkeyGroup, rounds uint64, relief WorryLevel, csv io.Writer) {
+	if csv != nil {
+		WriteCsvHeader(group, csv)
+	}
+	for i := uint64(1); i <= rounds; i++ {
+		Round(group, relief)
+		if csv != nil {
+			WriteCsvRow(group, i, csv)
+		}
+	}
+}
+
+const usage = "day11 [flags] [1|2] [verify|cycles|narrate [rounds...]|dot|direct]"
+
+type Options struct {
+	Part    int
+	Mode    string
+	Show    []int
+	Rounds  uint64
+	Relief  WorryLevel
+	Top     int
+	CsvPath string
+}
+
+func ParseOptions(args []string) (opts Options, err error) {
+	flags := flag.NewFlagSet("day11", flag.ContinueOnError)
+	flags.Uint64Var(&opts.Rounds, "rounds", 0, "number of rounds (default 20 in part 1 and in verify mode, 10000 in part 2)")
+	relief := flags.Uint64("relief", 0, "divisor applied to worry levels after inspection, 1 for none (default 3 in part 1, none in part 2)")
+	flags.IntVar(&opts.Top, "top", 2, "number of most active monkeys multiplied into the monkey business")
+	flags.StringVar(&opts.CsvPath, "csv", "", "write inspection counts after every round to this CSV file")
+	if err = flags.Parse(args); err != nil {
+		return
+	}
+
+	rest := flags.Args()
+	opts.Part = 1
+	if len(rest) > 0 {
+		switch rest[0] {
+		case "1":
+		case "2":
+			opts.Part = 2
+		default:
+			return opts, fmt.Errorf("Unknown part %q, usage: %s", rest[0], usage)
+		}
+		rest = rest[1:]
+	}
+	if len(rest) > 0 {
+		opts.Mode, rest = rest[0], rest[1:]
+	}
+	switch opts.Mode {
+	case "narrate":
+		for _, arg := range rest {
+			round, err := strconv.Atoi(arg)
+			if err != nil {
+				return opts, fmt.Errorf("Invalid round %q to narrate", arg)
+			}
+			opts.Show = append(opts.Show, round)
+		}
+		rest = nil
+	case "", "direct", "verify", "cycles", "dot":
+	default:
+		return opts, fmt.Errorf("Unknown mode %q, usage: %s", opts.Mode, usage)
+	}
+	if len(rest) > 0 {
+		return opts, fmt.Errorf("Unexpected arguments %q, usage: %s", rest, usage)
+	}
+	if opts.CsvPath != "" && (opts.Mode == "verify" || opts.Mode == "cycles") {
+		return opts, fmt.Errorf("-csv cannot be used in %s mode, which does not simulate the rounds one by one", opts.Mode)
+	}
+
+	// The exact worry levels of verify mode grow too fast for the part 2
+	// round count.
+	if opts.Rounds == 0 {
+		opts.Rounds = 20
+		if opts.Part == 2 && opts.Mode != "verify" {
+			opts.Rounds = 10000
+		}
+	}
+	opts.Relief = WorryLevel(*relief)
+	if opts.Relief == 0 {
+		opts.Relief = 3
+		if opts.Part == 2 {
+			opts.Relief = NoRelief
+		}
+	}
+	return
 }
 
-func (selector *TopSelector) MonkeyBusiness() uint64 {
-	return selector.first * selector.second
+// Run simulates the group as the options say and prints the result to out.
+// Inspection counts go to csv after every round if it is not nil.
+func Run(group *MonkeyGroup, opts Options, out, csv io.Writer) error {
+	group.UseModulus(opts.Relief == NoRelief)
+
+	switch opts.Mode {
+	case "verify":
+		if err := VerifyRounds(group, opts.Relief, opts.Rounds); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "%d rounds verified\n", opts.Rounds)
+		return nil
+	case "cycles":
+		if opts.Relief != NoRelief {
+			return errors.New("Cycle detection is only possible without relief")
+		}
+		SimulateCycles(group, opts.Rounds)
+	case "narrate":
+		group.SetNarrator(NewNarrator(out, opts.Show))
+		RunRounds(group, opts.Rounds, opts.Relief, csv)
+	case "dot":
+		RunRounds(group, opts.Rounds, opts.Relief, csv)
+		return WriteDot(group, out)
+	default:
+		RunRounds(group, opts.Rounds, opts.Relief, csv)
+	}
+
+	selector := MakeTopSelector(opts.Top)
+	for _, num := range group.MonkeyIds() {
+		selector.Insert(group.Monkey(num).InspectCount)
+	}
+	fmt.Fprintln(out, selector.MonkeyBusiness())
+	return nil
 }
 
 func main() {
-	mode1 := true
-	if (len(os.Args) > 1) && (os.Args[1] == "2") {
-		mode1 = false
+	opts, err := ParseOptions(os.Args[1:])
+	if err == flag.ErrHelp {
+		return
+	} else if err != nil {
+		panic(err)
 	}
 
 	scanner := bufio.NewScanner(os.Stdin)
 	monkeyGroup := ParseMonkeyGroup(scanner)
 
-	rounds := 20
-	if !mode1 {
-		rounds = 10000
-	}
-	for i := 0; i < rounds; i++ {
-		Round(monkeyGroup, mode1)
+	var csv io.Writer
+	if opts.CsvPath != "" {
+		f, err := os.Create(opts.CsvPath)
+		if err != nil {
+			panic(err)
+		}
+		defer f.Close()
+		w := bufio.NewWriter(f)
+		defer w.Flush()
+		csv = w
 	}
 
-	selector := TopSelector{}
-	for i := 0; i < monkeyGroup.NumMonkeys(); i++ {
-		ic := monkeyGroup.Monkey(i).InspectCount
-		//fmt.Printf("%d: %d\n", i, ic)
-		selector.Insert(ic)
+	if err := Run(monkeyGroup, opts, os.Stdout, csv); err != nil {
+		panic(err)
 	}
-
-	fmt.Println(selector.MonkeyBusiness())
 }
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func RunTest(t *testing.T, args ...string) string {
+	opts, err := ParseOptions(args)
+	if err != nil {
+		t.Fatalf("RunTest(t, %q): %v", args, err)
+	}
+	var out bytes.Buffer
+	if err := Run(LoadTestGroup(t), opts, &out, nil); err != nil {
+		t.Fatalf("RunTest(t, %q): %v", args, err)
+	}
+	return out.String()
+}
+
+func AssertOutput(t *testing.T, args []string, expected ...string) {
+	out := RunTest(t, args...)
+	for _, line := range expected {
+		if !strings.Contains(out, line) {
+			t.Fatalf("AssertOutput(t, %q): %q not found in\n%s", args, line, out)
+		}
+	}
+}
+
+func AssertOptionsErr(t *testing.T, args []string, expected string) {
+	_, err := ParseOptions(args)
+	if err == nil || !strings.Contains(err.Error(), expected) {
+		t.Fatalf("AssertOptionsErr(t, %q, %q): got %v", args, expected, err)
+	}
+}
+
+func TestNarrate(t *testing.T) {
+	AssertOutput(t, []string{"1", "narrate", "1"},
+		"Monkey 0:\n"+
+			"  Monkey inspects an item with a worry level of 79.\n"+
+			"    Worry level is multiplied by 19 to 1501.\n"+
+			"    Monkey gets bored with item. Worry level is divided by 3 to 500.\n"+
+			"    Current worry level is not divisible by 23.\n"+
+			"    Item with worry level 500 is thrown to monkey 3.\n",
+		"After round 1, the monkeys are holding items with these worry levels:\n"+
+			"Monkey 0: 20, 23, 27, 26\n"+
+			"Monkey 1: 2080, 25, 167, 207, 401, 1046\n",
+		"10605\n")
+
+	out := RunTest(t, "1", "narrate", "2")
+	if strings.Contains(out, "After round 1,") || !strings.Contains(out, "After round 2,") {
+		t.Fatalf("TestNarrate: only round 2 expected in\n%s", out)
+	}
+}
+
+func TestDot(t *testing.T) {
+	AssertOutput(t, []string{"1", "dot"},
+		"digraph monkeys {\n",
+		"  m0 [label=\"Monkey 0\\n101 inspections\"];\n  m0 -> m3 [label=\"101\", weight=101];\n",
+		"  m1 -> m0 [label=\"91\", weight=91];\n  m1 -> m2 [label=\"4\", weight=4];\n")
+}
+
+func TestOptionsErrors(t *testing.T) {
+	AssertOptionsErr(t, []string{"dot"}, "Unknown part \"dot\"")
+	AssertOptionsErr(t, []string{"verify"}, "Unknown part \"verify\"")
+	AssertOptionsErr(t, []string{"2", "1"}, "Unknown mode \"1\"")
+	AssertOptionsErr(t, []string{"1", "narrate", "x"}, "Invalid round \"x\"")
+	AssertOptionsErr(t, []string{"1", "dot", "extra"}, "Unexpected arguments")
+}
+
+func TestOptions(t *testing.T) {
+	for _, test := range []struct {
+		args   []string
+		rounds uint64
+		relief WorryLevel
+	}{
+		{[]string{}, 20, 3},
+		{[]string{"2"}, 10000, NoRelief},
+		{[]string{"2", "verify"}, 20, NoRelief},
+		{[]string{"-rounds", "5", "-relief", "2", "2", "verify"}, 5, 2},
+	} {
+		opts, err := ParseOptions(test.args)
+		if err != nil || opts.Rounds != test.rounds || opts.Relief != test.relief {
+			t.Fatalf("TestOptions: %q gave %d rounds and relief %d, expected %d and %d, err %v",
+				test.args, opts.Rounds, opts.Relief, test.rounds, test.relief, err)
+		}
+	}
+	AssertOptionsErr(t, []string{"-csv", "out.csv", "2", "cycles"}, "-csv cannot be used in cycles mode")
+	AssertOptionsErr(t, []string{"-csv", "out.csv", "2", "verify"}, "-csv cannot be used in verify mode")
+}
+
+func TestOverrides(t *testing.T) {
+	AssertOutput(t, []string{"-rounds", "1000", "2"}, "27019168\n")
+	AssertOutput(t, []string{"-top", "3"}, "1007475\n")
+	AssertOutput(t, []string{"-relief", "1"}, "10197\n")
+	AssertOutput(t, []string{"-relief", "3", "-rounds", "20", "2"}, "10605\n")
+}
+
+func TestVerify(t *testing.T) {
+	AssertOutput(t, []string{"1", "verify"}, "20 rounds verified\n")
+	AssertOutput(t, []string{"2", "verify"}, "20 rounds verified\n")
+}
+
+func TestCsv(t *testing.T) {
+	opts, err := ParseOptions([]string{"-rounds", "2", "2"})
+	if err != nil {
+		t.Fatalf("TestCsv: %v", err)
+	}
+	var out, csv bytes.Buffer
+	if err := Run(LoadTestGroup(t), opts, &out, &csv); err != nil {
+		t.Fatalf("TestCsv: %v", err)
+	}
+	expected := "round,monkey 0,monkey 1,monkey 2,monkey 3\n1,2,4,3,6\n2,6,10,3,10\n"
+	if csv.String() != expected {
+		t.Fatalf("TestCsv: expected\n%sgot\n%s", expected, csv.String())
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+type Narrator struct {
+	out    io.Writer
+	rounds map[int]bool
+	round  int
+}
+
+// NewNarrator creates a narrator for the given rounds, counted from 1. An
+// empty list means every round is narrated.
+func NewNarrator(out io.Writer, rounds []int) (result *Narrator) {
+	result = new(Narrator)
+	result.out = out
+	result.round = 1
+	if len(rounds) > 0 {
+		result.rounds = make(map[int]bool)
+		for _, round := range rounds {
+			result.rounds[round] = true
+		}
+	}
+	return
+}
+
+func (narrator *Narrator) Active() bool {
+	return narrator != nil && (narrator.rounds == nil || narrator.rounds[narrator.round])
+}
+
+func DescribeOperation(expr *Expr) string {
+	if expr.Kind == ExprBinary && expr.Lhs.Kind == ExprOld {
+		if expr.Rhs.Kind == ExprOld {
+			switch expr.Op {
+			case '*':
+				return "is multiplied by itself"
+			case '+':
+				return "is doubled"
+			}
+		} else if expr.Rhs.Kind == ExprLiteral {
+			switch expr.Op {
+			case '*':
+				return fmt.Sprintf("is multiplied by %d", expr.Rhs.Value)
+			case '+':
+				return fmt.Sprintf("increases by %d", expr.Rhs.Value)
+			case '-':
+				return fmt.Sprintf("decreases by %d", expr.Rhs.Value)
+			case '%':
+				return fmt.Sprintf("is reduced modulo %d", expr.Rhs.Value)
+			}
+		}
+	}
+	return fmt.Sprintf("becomes %v", expr)
+}
+
+func (narrator *Narrator) BeginTurn(cur int) {
+	fmt.Fprintf(narrator.out, "Monkey %d:\n", cur)
+}
+
+func (narrator *Narrator) Inspect(monkey *Monkey, item, inspected, relieved, relief WorryLevel, target int) {
+	fmt.Fprintf(narrator.out, "  Monkey inspects an item with a worry level of %d.\n", item)
+	fmt.Fprintf(narrator.out, "    Worry level %s to %d.\n", DescribeOperation(monkey.Expression), inspected)
+	if relief != NoRelief {
+		fmt.Fprintf(narrator.out, "    Monkey gets bored with item. Worry level is divided by %d to %d.\n", relief, relieved)
+	}
+	not := "not "
+	if relieved%monkey.Rule.DivBy == 0 {
+		not = ""
+	}
+	fmt.Fprintf(narrator.out, "    Current worry level is %sdivisible by %d.\n", not, monkey.Rule.DivBy)
+	fmt.Fprintf(narrator.out, "    Item with worry level %d is thrown to monkey %d.\n", relieved, target)
+}
+
+func (narrator *Narrator) EndRound(group *MonkeyGroup) {
+	if narrator.Active() {
+		fmt.Fprintf(narrator.out, "\nAfter round %d, the monkeys are holding items with these worry levels:\n", narrator.round)
+		for _, i := range group.MonkeyIds() {
+			items := make([]string, len(group.Monkey(i).Items))
+			for j, item := range group.Monkey(i).Items {
+				items[j] = fmt.Sprint(item)
+			}
+			fmt.Fprintf(narrator.out, "Monkey %d: %s\n", i, strings.Join(items, ", "))
+		}
+		fmt.Fprintln(narrator.out)
+	}
+	narrator.round++
+}
+
+func WriteDot(group *MonkeyGroup, out io.Writer) error {
+	w := bufio.NewWriter(out)
+	fmt.Fprintln(w, "digraph monkeys {")
+	for _, i := range group.MonkeyIds() {
+		monkey := group.Monkey(i)
+		fmt.Fprintf(w, "  m%d [label=\"Monkey %d\\n%d inspections\"];\n", i, i, monkey.InspectCount)
+
+		targets := []int{}
+		for target := range monkey.Throws {
+			targets = append(targets, target)
+		}
+		sort.Ints(targets)
+		for _, target := range targets {
+			count := monkey.Throws[target]
+			fmt.Fprintf(w, "  m%d -> m%d [label=\"%d\", weight=%d];\n", i, target, count, count)
+		}
+	}
+	fmt.Fprintln(w, "}")
+	return w.Flush()
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+)
+
+type BigSimulation struct {
+	group  *MonkeyGroup
+	items  map[int][]*big.Int
+	counts map[int]uint64
+}
+
+func NewBigSimulation(group *MonkeyGroup) (result *BigSimulation) {
+	result = new(BigSimulation)
+	result.group = group
+	result.items = make(map[int][]*big.Int)
+	result.counts = make(map[int]uint64)
+	for num, monkey := range group.monkeys {
+		for _, item := range monkey.Items {
+			result.items[num] = append(result.items[num], new(big.Int).SetUint64(uint64(item)))
+		}
+	}
+	return
+}
+
+func (sim *BigSimulation) Turn(cur int, relief WorryLevel) {
+	monkey := sim.group.Monkey(cur)
+	divisor := new(big.Int).SetUint64(uint64(relief))
+	divBy := new(big.Int).SetUint64(uint64(monkey.Rule.DivBy))
+	rem := new(big.Int)
+
+	for _, item := range sim.items[cur] {
+		wl := monkey.Expression.EvalBig(item)
+		if relief != NoRelief {
+			wl.Div(wl, divisor)
+		}
+		target := monkey.Rule.IfFalse
+		if rem.Mod(wl, divBy).Sign() == 0 {
+			target = monkey.Rule.IfTrue
+		}
+		sim.items[target] = append(sim.items[target], wl)
+		sim.counts[cur]++
+	}
+	sim.items[cur] = sim.items[cur][:0]
+}
+
+func (sim *BigSimulation) Round(relief WorryLevel) {
+	for _, num := range sim.group.MonkeyIds() {
+		sim.Turn(num, relief)
+	}
+}
+
+func (sim *BigSimulation) InspectCount(num int) uint64 {
+	return sim.counts[num]
+}
+
+func VerifyRounds(group *MonkeyGroup, relief WorryLevel, rounds uint64) error {
+	sim := NewBigSimulation(group)
+	for round := uint64(1); round <= rounds; round++ {
+		Round(group, relief)
+		sim.Round(relief)
+		for _, i := range group.MonkeyIds() {
+			fast, exact := group.Monkey(i).InspectCount, sim.InspectCount(i)
+			if fast != exact {
+				return fmt.Errorf("Round %d: monkey %d inspected %d items, but %d with exact worry levels", round, i, fast, exact)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// WriteCsv writes the distance of every cell, or -1 for unreachable cells.
+func (dmap *DistanceMap) WriteCsv(out io.Writer) error {
+	w := bufio.NewWriter(out)
+	for y := 0; y < dmap.YSize(); y++ {
+		for x := 0; x < dmap.XSize(); x++ {
+			if x > 0 {
+				w.WriteByte(',')
+			}
+			node := dmap.At(Pos{x, y})
+			if node.Calculated {
+				fmt.Fprint(w, node.Distance)
+			} else {
+				w.WriteString("-1")
+			}
+		}
+		w.WriteByte('\n')
+	}
+	return w.Flush()
+}
+
+// PgmMaxValue is the largest gray level a PGM file may use.
+const PgmMaxValue = 65535
+
+// WritePgm writes the distance field as a heatmap: the source of the field
+// is white, brightness fades with distance and unreachable cells are black.
+// Distances are scaled down if there are more of them than gray levels.
+func (dmap *DistanceMap) WritePgm(out io.Writer) error {
+	maxDist := 0
+	for _, node := range dmap.nodes {
+		if node.Calculated && node.Distance > maxDist {
+			maxDist = node.Distance
+		}
+	}
+	maxValue := maxDist + 1
+	if maxValue > PgmMaxValue {
+		maxValue = PgmMaxValue
+	}
+	gray := func(dist int) int {
+		if maxDist+1 <= PgmMaxValue {
+			return maxDist + 1 - dist
+		}
+		return 1 + int(int64(maxDist-dist)*(PgmMaxValue-1)/int64(maxDist))
+	}
+
+	w := bufio.NewWriter(out)
+	fmt.Fprintf(w, "P2\n%d %d\n%d\n", dmap.XSize(), dmap.YSize(), maxValue)
+	for y := 0; y < dmap.YSize(); y++ {
+		for x := 0; x < dmap.XSize(); x++ {
+			if x > 0 {
+				w.WriteByte(' ')
+			}
+			node := dmap.At(Pos{x, y})
+			if node.Calculated {
+				fmt.Fprint(w, gray(node.Distance))
+			} else {
+				w.WriteByte('0')
+			}
+		}
+		w.WriteByte('\n')
+	}
+	return w.Flush()
+}
+
+func (dmap *DistanceMap) Export(path string) error {
+	var write func(io.Writer) error
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		write = dmap.WriteCsv
+	case ".pgm":
+		write = dmap.WritePgm
+	default:
+		return errors.New("Export file must have .csv or .pgm extension")
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err = write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func ReadPgm(t *testing.T, data []byte) (width, height, maxValue int, values []int) {
+	r := bufio.NewReader(bytes.NewReader(data))
+	if _, err := fmt.Fscanf(r, "P2\n%d %d\n%d\n", &width, &height, &maxValue); err != nil {
+		t.Fatalf("ReadPgm: invalid header: %v", err)
+	}
+	values = make([]int, width*height)
+	for i := range values {
+		if _, err := fmt.Fscan(r, &values[i]); err != nil {
+			t.Fatalf("ReadPgm: value %d: %v", i, err)
+		}
+	}
+	return
+}
+
+func TestWritePgm(t *testing.T) {
+	hmap, _, end := LoadTestMap(t)
+	dmap := MakeDistanceMap(&hmap, end, true)
+	dmap.Fill()
+	var buf bytes.Buffer
+	dmap.WritePgm(&buf)
+	_, _, maxValue, values := ReadPgm(t, buf.Bytes())
+	if maxValue != 32 || values[0] != 32-31 || values[2*hmap.XSize()+5] != 32 {
+		t.Fatalf("TestWritePgm: maxval %d, start %d, end %d", maxValue, values[0], values[2*hmap.XSize()+5])
+	}
+
+	// A single row of y cells that has to be walked from the end to reach
+	// the far side.
+	const length = 100000
+	src := "S" + strings.Repeat("y", length) + "E"
+	scanner := bufio.NewScanner(strings.NewReader(src))
+	scanner.Buffer(nil, 2*length)
+	hmap, _, end = ParseHeightMap(scanner)
+	dmap = MakeDistanceMap(&hmap, end, true)
+	dmap.Fill()
+	buf.Reset()
+	dmap.WritePgm(&buf)
+	width, _, maxValue, values := ReadPgm(t, buf.Bytes())
+	if width != length+2 || maxValue != PgmMaxValue {
+		t.Fatalf("TestWritePgm: width %d, maxval %d", width, maxValue)
+	}
+	if values[0] != 0 || values[1] != 1 || values[length+1] != PgmMaxValue {
+		t.Fatalf("TestWritePgm: unreachable %d, farthest %d, end %d", values[0], values[1], values[length+1])
+	}
+	for i := 2; i < len(values); i++ {
+		if values[i] < values[i-1] {
+			t.Fatalf("TestWritePgm: gray level falls from %d to %d at %d", values[i-1], values[i], i)
+		}
+	}
+}
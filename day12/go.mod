@@ -1,8 +1,3 @@
 module github.com/iskostarev/aoc2022/day12
 
 go 1.19
-
-require (
-	github.com/deckarep/golang-set v1.8.0 // indirect
-	github.com/deckarep/golang-set/v2 v2.1.0 // indirect
-)
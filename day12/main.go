@@ -2,11 +2,10 @@ package main
 
 import (
 	"bufio"
+	"flag"
 	"fmt"
 	"os"
 	"strings"
-
-	mapset "github.com/deckarep/golang-set/v2"
 )
 
 type Height byte
@@ -16,21 +15,23 @@ type Pos struct {
 }
 
 type HeightMap struct {
-	grid  [][]Height
-	xsize int
+	grid    [][]Height
+	xsize   int
+	markers map[byte]Pos
 }
 
 type DistanceNode struct {
 	Calculated bool
-	Traversed  bool
 	Distance   int
+	Prev       Pos
 }
 
 type DistanceMap struct {
 	hmap         *HeightMap
 	nodes        []DistanceNode
 	xsize, ysize int
-	next         mapset.Set[Pos]
+	queue        []Pos
+	head         int
 	inverse      bool
 }
 
@@ -44,6 +45,7 @@ func EligibleMove(from, to Height) bool {
 
 func MakeHeightMap() (result HeightMap) {
 	result.grid = make([][]Height, 0)
+	result.markers = make(map[byte]Pos)
 	return
 }
 
@@ -57,6 +59,20 @@ func (hmap *HeightMap) AppendRow(row []Height) int {
 	return len(hmap.grid)
 }
 
+// AddMarker records a waypoint marker. Markers are the capital letters other
+// than S and E and stand for the corresponding lowercase height.
+func (hmap *HeightMap) AddMarker(marker byte, pos Pos) {
+	if _, exists := hmap.markers[marker]; exists {
+		panic(fmt.Sprintf("Marker %c already set", marker))
+	}
+	hmap.markers[marker] = pos
+}
+
+func (hmap *HeightMap) Marker(marker byte) (pos Pos, ok bool) {
+	pos, ok = hmap.markers[marker]
+	return
+}
+
 func (hmap *HeightMap) XSize() int {
 	return hmap.xsize
 }
@@ -96,6 +112,9 @@ func ParseHeightMap(scanner *bufio.Scanner) (hmap HeightMap, startPos, endPos Po
 			} else if c == 'E' {
 				setPos(&endPos, &endFlag, x, y)
 				c = 'z'
+			} else if c >= 'A' && c <= 'Z' {
+				hmap.AddMarker(c, Pos{x, y})
+				c += 'a' - 'A'
 			}
 			row[x] = CharToHeight(c)
 		}
@@ -106,7 +125,7 @@ func ParseHeightMap(scanner *bufio.Scanner) (hmap HeightMap, startPos, endPos Po
 	return
 }
 
-func (hmap *HeightMap) TraverseEligibleDestinations(inverse bool, from Pos, cb func(Pos)) {
+func (hmap *HeightMap) TraverseNeighbours(from Pos, cb func(Pos)) {
 	checkDst := func(x, y int) {
 		if x < 0 || x >= hmap.XSize() {
 			return
@@ -114,7 +133,17 @@ func (hmap *HeightMap) TraverseEligibleDestinations(inverse bool, from Pos, cb f
 		if y < 0 || y >= hmap.YSize() {
 			return
 		}
-		to := Pos{x, y}
+		cb(Pos{x, y})
+	}
+
+	checkDst(from.X-1, from.Y)
+	checkDst(from.X+1, from.Y)
+	checkDst(from.X, from.Y-1)
+	checkDst(from.X, from.Y+1)
+}
+
+func (hmap *HeightMap) TraverseEligibleDestinations(inverse bool, from Pos, cb func(Pos)) {
+	hmap.TraverseNeighbours(from, func(to Pos) {
 		a, b := hmap.At(from), hmap.At(to)
 		if inverse {
 			a, b = b, a
@@ -122,12 +151,18 @@ func (hmap *HeightMap) TraverseEligibleDestinations(inverse bool, from Pos, cb f
 		if EligibleMove(a, b) {
 			cb(to)
 		}
-	}
+	})
+}
 
-	checkDst(from.X-1, from.Y)
-	checkDst(from.X+1, from.Y)
-	checkDst(from.X, from.Y-1)
-	checkDst(from.X, from.Y+1)
+func (hmap *HeightMap) PositionsOfHeight(height Height) (result []Pos) {
+	for y := 0; y < hmap.YSize(); y++ {
+		for x := 0; x < hmap.XSize(); x++ {
+			if hmap.grid[y][x] == height {
+				result = append(result, Pos{x, y})
+			}
+		}
+	}
+	return
 }
 
 func MakeDistanceMap(hmap *HeightMap, start Pos, inverse bool) (result DistanceMap) {
@@ -135,11 +170,11 @@ func MakeDistanceMap(hmap *HeightMap, start Pos, inverse bool) (result DistanceM
 	result.xsize = hmap.XSize()
 	result.ysize = hmap.YSize()
 	result.nodes = make([]DistanceNode, result.xsize*result.ysize)
-	result.next = mapset.NewThreadUnsafeSet[Pos]()
+	result.queue = []Pos{start}
 	result.inverse = inverse
 
 	result.At(start).Calculated = true
-	result.next.Add(start)
+	result.At(start).Prev = start
 	return
 }
 
@@ -156,31 +191,22 @@ func (dmap *DistanceMap) At(pos Pos) *DistanceNode {
 }
 
 func (dmap *DistanceMap) Propagate() bool {
-	if dmap.next.Cardinality() == 0 {
+	if dmap.head == len(dmap.queue) {
 		return false
 	}
 
-	next := mapset.NewThreadUnsafeSet[Pos]()
-	dmap.next.Each(func(from Pos) bool {
-		fromNode := dmap.At(from)
-		if fromNode.Traversed {
-			return false
+	from := dmap.queue[dmap.head]
+	dmap.head++
+	fromNode := dmap.At(from)
+	dmap.hmap.TraverseEligibleDestinations(dmap.inverse, from, func(to Pos) {
+		toNode := dmap.At(to)
+		if !toNode.Calculated {
+			toNode.Calculated = true
+			toNode.Distance = fromNode.Distance + 1
+			toNode.Prev = from
+			dmap.queue = append(dmap.queue, to)
 		}
-		//fmt.Printf("from %v\n", from)
-		dmap.hmap.TraverseEligibleDestinations(dmap.inverse, from, func(to Pos) {
-			//fmt.Printf("%v -> %v\n", from, to)
-			next.Add(to)
-			toNode := dmap.At(to)
-			if !toNode.Calculated {
-				toNode.Calculated = true
-				toNode.Distance = fromNode.Distance + 1
-				//fmt.Printf("%v: dist %d\n", to, toNode.Distance)
-			}
-		})
-		fromNode.Traversed = true
-		return false
 	})
-	dmap.next = next
 	return true
 }
 
@@ -196,65 +222,165 @@ func (dmap *DistanceMap) CalcDistanceTo(target Pos) (int, bool) {
 	}
 }
 
-func (dmap *DistanceMap) CalcMinDistanceFromHeight(start Height) (result int) {
-	found := false
-	for x := 0; x < dmap.XSize(); x++ {
-		for y := 0; y < dmap.YSize(); y++ {
-			pos := Pos{x, y}
-			if dmap.hmap.At(pos) != start {
-				continue
-			}
-
-			dist, ok := dmap.CalcDistanceTo(pos)
-			if !ok {
-				continue
-			}
-			if !found || dist < result {
-				result = dist
-				found = true
-			}
-		}
-	}
-	if !found {
-		panic("No path was found")
+// Fill runs the search to completion, calculating the whole distance field.
+func (dmap *DistanceMap) Fill() {
+	for dmap.Propagate() {
 	}
-	return
 }
 
-func (dmap *DistanceMap) String() (result string) {
-	for y := 0; y < dmap.YSize(); y++ {
-		for x := 0; x < dmap.XSize(); x++ {
-			node := dmap.At(Pos{x, y})
-			if node.Calculated {
-				result += fmt.Sprintf("[%03d]", node.Distance)
-			} else {
-				result += "[???]"
+// NearestOfHeight finds the closest cell of the given height. Cells leave the
+// queue in order of distance, so the first matching one is the nearest, and
+// the search only runs as far as needed.
+func (dmap *DistanceMap) NearestOfHeight(height Height) (dist int, pos Pos, found bool) {
+	for i := 0; ; i++ {
+		for i == len(dmap.queue) {
+			if !dmap.Propagate() {
+				return -1, pos, false
 			}
 		}
-		result += "\n"
+		pos = dmap.queue[i]
+		if dmap.hmap.At(pos) == height {
+			return dmap.At(pos).Distance, pos, true
+		}
 	}
-	return
 }
 
 func main() {
-	mode1 := true
-	if (len(os.Args) > 1) && (os.Args[1] == "2") {
-		mode1 = false
+	solver := flag.String("solver", "bfs", "search algorithm: bfs, dijkstra or astar")
+	rule := DefaultClimbRule
+	flag.IntVar(&rule.MaxUp, "up", rule.MaxUp, "maximum climb per move, negative for no limit")
+	flag.IntVar(&rule.MaxDown, "down", rule.MaxDown, "maximum descent per move, negative for no limit")
+	flag.IntVar(&rule.StepCost, "step-cost", rule.StepCost, "cost of every move")
+	flag.IntVar(&rule.UpCost, "up-cost", rule.UpCost, "additional cost per unit of height climbed")
+	flag.IntVar(&rule.DownCost, "down-cost", rule.DownCost, "additional cost per unit of height descended")
+	export := flag.String("export", "", "write the BFS distance field from the end to a .csv or .pgm file")
+	heightFlag := flag.String("height", "a", "starting height in part 2")
+	waypointList := flag.String("waypoints", "", "tour waypoints separated by ';', each a marker letter or x,y (default S, all markers, E)")
+	fixFirst := flag.Bool("fix-first", false, "start the tour at the first waypoint")
+	fixLast := flag.Bool("fix-last", false, "end the tour at the last waypoint")
+	top := flag.Int("top", 10, "number of single-cell edits listed by terraform")
+	target := flag.Int("target", 0, "path length that terraform should reach with the fewest edits")
+	maxEdits := flag.Int("max-edits", 5, "maximum number of edits terraform tries to reach the target length")
+	flag.Parse()
+	if len(*heightFlag) != 1 {
+		panic("Height must be a single letter")
 	}
+	height := (*heightFlag)[0]
+
+	mode1 := flag.Arg(0) != "2"
+	showRoute := flag.Arg(1) == "route"
 
 	scanner := bufio.NewScanner(os.Stdin)
 	hmap, startPos, endPos := ParseHeightMap(scanner)
 
-	if mode1 {
-		dmap := MakeDistanceMap(&hmap, startPos, false)
-		dist, found := dmap.CalcDistanceTo(endPos)
+	if flag.Arg(0) == "terraform" {
+		current, found := hmap.ShortestDistance(startPos, endPos)
+		if found {
+			fmt.Printf("current distance: %d\n", current)
+		} else {
+			fmt.Println("no path from S to E")
+		}
+		for i, edit := range RankSingleEdits(&hmap, startPos, endPos) {
+			if i == *top {
+				break
+			}
+			fmt.Printf("%d. %v: %d\n", i+1, edit, edit.Distance)
+		}
+		if *target > 0 {
+			edits, length, found, exact := MinEdits(&hmap, startPos, endPos, *target, *maxEdits)
+			if !found && exact {
+				fmt.Printf("length %d cannot be reached with at most %d edits\n", *target, *maxEdits)
+				return
+			} else if !found {
+				fmt.Printf("no edits reaching length %d were found, but at most %d edits might still suffice\n", *target, *maxEdits)
+				return
+			}
+			fmt.Printf("%d edits reach length %d:\n", len(edits), length)
+			if !exact {
+				fmt.Println("  (fewer edits might suffice, the search could not rule them out)")
+			}
+			for _, edit := range edits {
+				fmt.Printf("  %v at step %d\n", edit, edit.Distance)
+			}
+		}
+		return
+	}
+
+	if flag.Arg(0) == "tour" {
+		waypoints := DefaultWaypoints(&hmap, startPos, endPos)
+		if *waypointList != "" {
+			var err error
+			if waypoints, err = ParseWaypoints(*waypointList, &hmap, startPos, endPos); err != nil {
+				panic(err)
+			}
+		}
+		tour, found := ShortestTour(PairwiseDistances(&hmap, waypoints), *fixFirst, *fixLast)
+		if !found {
+			panic("No tour was found")
+		}
+		tour.Print(waypoints)
+		return
+	}
+
+	var dist int
+	var route []Pos
+	switch *solver {
+	case "bfs":
+		if rule != DefaultClimbRule {
+			panic("The BFS solver only supports the default climbing rule")
+		}
+		var dmap DistanceMap
+		target := endPos
+		if mode1 {
+			dmap = MakeDistanceMap(&hmap, startPos, false)
+			var found bool
+			dist, found = dmap.CalcDistanceTo(endPos)
+			if !found {
+				panic("No path was found")
+			}
+		} else {
+			dmap = MakeDistanceMap(&hmap, endPos, true)
+			var found bool
+			dist, target, found = dmap.NearestOfHeight(CharToHeight(height))
+			if !found {
+				panic("No path was found")
+			}
+		}
+		if showRoute {
+			route, _ = dmap.Route(target)
+		}
+		if *export != "" {
+			field := dmap
+			if mode1 {
+				field = MakeDistanceMap(&hmap, endPos, true)
+			}
+			field.Fill()
+			if err := field.Export(*export); err != nil {
+				panic(err)
+			}
+		}
+	case "dijkstra", "astar":
+		if *export != "" {
+			panic("Only the BFS solver can export the distance field")
+		}
+		if rule.StepCost < 0 || rule.UpCost < 0 || rule.DownCost < 0 {
+			panic("Move costs must not be negative")
+		}
+		sources := []Pos{startPos}
+		if !mode1 {
+			sources = hmap.PositionsOfHeight(CharToHeight(height))
+		}
+		var found bool
+		dist, route, found = WeightedSearch(&hmap, rule, sources, endPos, *solver == "astar")
 		if !found {
 			panic("No path was found")
 		}
-		fmt.Println(dist)
-	} else {
-		dmap := MakeDistanceMap(&hmap, endPos, true)
-		dist := dmap.CalcMinDistanceFromHeight(CharToHeight('a'))
-		fmt.Println(dist)
+	default:
+		panic(fmt.Sprintf("Unknown solver %q", *solver))
+	}
+
+	if showRoute {
+		fmt.Print(RenderRoute(&hmap, route))
 	}
+	fmt.Println(dist)
 }
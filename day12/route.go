@@ -0,0 +1,62 @@
+package main
+
+import (
+	"strings"
+)
+
+// Route returns the shortest route between the start of the distance map and
+// the target in the direction of travel, so it begins at the start for a
+// regular map and ends at the start for an inverse one.
+func (dmap *DistanceMap) Route(target Pos) ([]Pos, bool) {
+	if _, found := dmap.CalcDistanceTo(target); !found {
+		return nil, false
+	}
+
+	route := []Pos{target}
+	for pos := target; dmap.At(pos).Prev != pos; {
+		pos = dmap.At(pos).Prev
+		route = append(route, pos)
+	}
+
+	if !dmap.inverse {
+		for i, j := 0, len(route)-1; i < j; i, j = i+1, j-1 {
+			route[i], route[j] = route[j], route[i]
+		}
+	}
+	return route, true
+}
+
+func StepArrow(from, to Pos) byte {
+	switch {
+	case to.X == from.X+1 && to.Y == from.Y:
+		return '>'
+	case to.X == from.X-1 && to.Y == from.Y:
+		return '<'
+	case to.X == from.X && to.Y == from.Y-1:
+		return '^'
+	case to.X == from.X && to.Y == from.Y+1:
+		return 'v'
+	}
+	panic("Route positions are not adjacent")
+}
+
+func RenderRoute(hmap *HeightMap, route []Pos) string {
+	grid := make([][]byte, hmap.YSize())
+	for y := range grid {
+		grid[y] = []byte(strings.Repeat(".", hmap.XSize()))
+	}
+	for i := 0; i+1 < len(route); i++ {
+		grid[route[i].Y][route[i].X] = StepArrow(route[i], route[i+1])
+	}
+	if len(route) > 0 {
+		end := route[len(route)-1]
+		grid[end.Y][end.X] = 'E'
+	}
+
+	var sb strings.Builder
+	for _, row := range grid {
+		sb.Write(row)
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"testing"
+)
+
+func LoadTestMap(t *testing.T) (HeightMap, Pos, Pos) {
+	f, err := os.Open("test_input")
+	if err != nil {
+		t.Fatalf("LoadTestMap: %v", err)
+	}
+	defer f.Close()
+	return ParseHeightMap(bufio.NewScanner(f))
+}
+
+func AssertRoute(t *testing.T, hmap *HeightMap, route []Pos, first, last Pos, length int) {
+	if len(route) != length+1 || route[0] != first || route[len(route)-1] != last {
+		t.Fatalf("AssertRoute(t, hmap, %v, %v, %v, %d): wrong route", route, first, last, length)
+	}
+	for i := 0; i+1 < len(route); i++ {
+		StepArrow(route[i], route[i+1])
+		if !EligibleMove(hmap.At(route[i]), hmap.At(route[i+1])) {
+			t.Fatalf("AssertRoute(t, hmap, %v, %v, %v, %d): step %d is too steep", route, first, last, length, i)
+		}
+	}
+}
+
+func TestRoute(t *testing.T) {
+	hmap, start, end := LoadTestMap(t)
+
+	dmap := MakeDistanceMap(&hmap, start, false)
+	route, found := dmap.Route(end)
+	if !found {
+		t.Fatalf("TestRoute: no route to %v", end)
+	}
+	AssertRoute(t, &hmap, route, start, end, 31)
+
+	inverse := MakeDistanceMap(&hmap, end, true)
+	_, nearest, _ := inverse.NearestOfHeight(CharToHeight('a'))
+	route, _ = inverse.Route(nearest)
+	AssertRoute(t, &hmap, route, nearest, end, 29)
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+type CellEdit struct {
+	Pos      Pos
+	Old, New Height
+	Distance int
+}
+
+func (edit CellEdit) String() string {
+	return fmt.Sprintf("(%d,%d) %c -> %c", edit.Pos.X, edit.Pos.Y, edit.Old, edit.New)
+}
+
+func (hmap *HeightMap) Set(pos Pos, height Height) {
+	hmap.grid[pos.Y][pos.X] = height
+}
+
+func (hmap *HeightMap) ShortestDistance(start, end Pos) (int, bool) {
+	dmap := MakeDistanceMap(hmap, start, false)
+	return dmap.CalcDistanceTo(end)
+}
+
+// RankSingleEdits lists the single-cell height changes that shorten the path
+// from start to end, best first, with the best new height for every cell.
+//
+// A change of cell c only affects moves into and out of c, so the new
+// shortest path either avoids c, and is no shorter than before, or passes
+// through it. The original distances from the start and to the end give a
+// lower bound for the latter, and only the changes where that bound beats
+// the current distance are checked with a full search.
+func RankSingleEdits(hmap *HeightMap, start, end Pos) (result []CellEdit) {
+	forward := MakeDistanceMap(hmap, start, false)
+	forward.Fill()
+	backward := MakeDistanceMap(hmap, end, true)
+	backward.Fill()
+	current, reachable := forward.CalcDistanceTo(end)
+
+	for y := 0; y < hmap.YSize(); y++ {
+		for x := 0; x < hmap.XSize(); x++ {
+			pos := Pos{x, y}
+			if pos == start || pos == end {
+				continue
+			}
+			old := hmap.At(pos)
+
+			var best *CellEdit
+			for h := CharToHeight('a'); h <= CharToHeight('z'); h++ {
+				if h == old {
+					continue
+				}
+				bestIn, bestOut := -1, -1
+				hmap.TraverseNeighbours(pos, func(n Pos) {
+					if node := forward.At(n); node.Calculated && EligibleMove(hmap.At(n), h) {
+						if bestIn < 0 || node.Distance < bestIn {
+							bestIn = node.Distance
+						}
+					}
+					if node := backward.At(n); node.Calculated && EligibleMove(h, hmap.At(n)) {
+						if bestOut < 0 || node.Distance < bestOut {
+							bestOut = node.Distance
+						}
+					}
+				})
+				if bestIn < 0 || bestOut < 0 || (reachable && bestIn+bestOut+2 >= current) {
+					continue
+				}
+
+				hmap.Set(pos, h)
+				dist, ok := hmap.ShortestDistance(start, end)
+				hmap.Set(pos, old)
+				if !ok || (reachable && dist >= current) {
+					continue
+				}
+				if best == nil || dist < best.Distance || (dist == best.Distance && heightDelta(h, old) < heightDelta(best.New, old)) {
+					best = &CellEdit{pos, old, h, dist}
+				}
+			}
+			if best != nil {
+				result = append(result, *best)
+			}
+		}
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Distance < result[j].Distance
+	})
+	return
+}
+
+func heightDelta(a, b Height) int {
+	return Abs(int(a) - int(b))
+}
+
+// MinEdits finds the fewest cell edits that bring the path from start to end
+// down to at most target steps, trying up to maxEdits edits.
+//
+// The search runs over (cell, height, edits used) states: an edited cell is
+// always given the highest height the previous cell allows, since descending
+// is free and a higher cell never blocks the next move. The states do not
+// remember earlier edits, so a path may edit a cell twice or walk over an
+// edited cell as if it were not. That makes the search a relaxation: no
+// solution with e edits means none exists, but a solution has to be checked
+// on the edited map. If a cheaper relaxed solution fails the check, the
+// returned edits are not proven to be minimal and exact is false.
+func MinEdits(hmap *HeightMap, start, end Pos, target, maxEdits int) (edits []CellEdit, length int, found, exact bool) {
+	const heights = 'z' - 'a' + 1
+	cells := hmap.XSize() * hmap.YSize()
+	index := func(pos Pos, h Height, e int) int {
+		return (e*cells+pos.Y*hmap.XSize()+pos.X)*heights + int(h-'a')
+	}
+
+	type state struct {
+		pos Pos
+		h   Height
+		e   int
+	}
+	total := cells * heights * (maxEdits + 1)
+	dist := make([]int, total)
+	prev := make([]int, total)
+	for i := range dist {
+		dist[i] = -1
+	}
+
+	first := state{start, hmap.At(start), 0}
+	dist[index(first.pos, first.h, 0)] = 0
+	prev[index(first.pos, first.h, 0)] = -1
+	queue := []state{first}
+	visit := func(from, to state) {
+		i := index(to.pos, to.h, to.e)
+		if dist[i] >= 0 {
+			return
+		}
+		dist[i] = dist[index(from.pos, from.h, from.e)] + 1
+		prev[i] = index(from.pos, from.h, from.e)
+		queue = append(queue, to)
+	}
+
+	for head := 0; head < len(queue); head++ {
+		cur := queue[head]
+		hmap.TraverseNeighbours(cur.pos, func(n Pos) {
+			if h := hmap.At(n); EligibleMove(cur.h, h) {
+				visit(cur, state{n, h, cur.e})
+			}
+			if cur.e == maxEdits || n == start || n == end {
+				return
+			}
+			if h := minHeight(cur.h+1, 'z'); h != hmap.At(n) {
+				visit(cur, state{n, h, cur.e + 1})
+			}
+		})
+	}
+
+	exact = true
+	for e := 0; e <= maxEdits; e++ {
+		i := index(end, hmap.At(end), e)
+		if dist[i] < 0 || dist[i] > target {
+			continue
+		}
+
+		candidate := map[Pos]CellEdit{}
+		for ; i >= 0; i = prev[i] {
+			cell := i / heights % cells
+			pos := Pos{cell % hmap.XSize(), cell / hmap.XSize()}
+			h := Height(i%heights) + 'a'
+			if old, ok := candidate[pos]; h != hmap.At(pos) && (!ok || h > old.New) {
+				candidate[pos] = CellEdit{pos, hmap.At(pos), h, dist[i]}
+			}
+		}
+
+		for _, edit := range candidate {
+			hmap.Set(edit.Pos, edit.New)
+		}
+		length, found = hmap.ShortestDistance(start, end)
+		for _, edit := range candidate {
+			hmap.Set(edit.Pos, edit.Old)
+		}
+		if !found || length > target {
+			found = false
+			exact = false
+			continue
+		}
+
+		for _, edit := range candidate {
+			edits = append(edits, edit)
+		}
+		sort.Slice(edits, func(i, j int) bool {
+			return edits[i].Distance < edits[j].Distance
+		})
+		return
+	}
+	return
+}
+
+func minHeight(a, b Height) Height {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestSingleEdits(t *testing.T) {
+	hmap, start, end := LoadTestMap(t)
+	current, _ := hmap.ShortestDistance(start, end)
+
+	best := current
+	for y := 0; y < hmap.YSize(); y++ {
+		for x := 0; x < hmap.XSize(); x++ {
+			pos := Pos{x, y}
+			if pos == start || pos == end {
+				continue
+			}
+			old := hmap.At(pos)
+			for h := CharToHeight('a'); h <= CharToHeight('z'); h++ {
+				hmap.Set(pos, h)
+				if dist, ok := hmap.ShortestDistance(start, end); ok && dist < best {
+					best = dist
+				}
+			}
+			hmap.Set(pos, old)
+		}
+	}
+
+	ranked := RankSingleEdits(&hmap, start, end)
+	if len(ranked) == 0 || ranked[0].Distance != best {
+		t.Fatalf("TestSingleEdits: expected best distance %d, got %v", best, ranked)
+	}
+
+	edits, length, found, _ := MinEdits(&hmap, start, end, best, 1)
+	if !found || len(edits) != 1 || length != best {
+		t.Fatalf("TestSingleEdits: MinEdits found %v of length %d instead of a single edit", edits, length)
+	}
+}
+
+func TestMinEdits(t *testing.T) {
+	hmap, start, end := LoadTestMap(t)
+	// Below 29 steps the search finds no verified solution: at 27 and 28 a
+	// relaxed one fails the check, so the answer is not exact, and at 26 no
+	// path of 10 edits exists at all.
+	for _, test := range []struct {
+		target, edits, length int
+		found, exact          bool
+	}{
+		{31, 0, 31, true, true},
+		{30, 1, 29, true, true},
+		{29, 1, 29, true, true},
+		{28, 0, 0, false, false},
+		{27, 0, 0, false, false},
+		{26, 0, 0, false, true},
+	} {
+		edits, length, found, exact := MinEdits(&hmap, start, end, test.target, 10)
+		if found != test.found || exact != test.exact || len(edits) != test.edits || (found && length != test.length) {
+			t.Fatalf("TestMinEdits: target %d gave %v of length %d, found %v, exact %v", test.target, edits, length, found, exact)
+		}
+		if !found {
+			continue
+		}
+
+		for _, edit := range edits {
+			hmap.Set(edit.Pos, edit.New)
+		}
+		dist, ok := hmap.ShortestDistance(start, end)
+		for _, edit := range edits {
+			hmap.Set(edit.Pos, edit.Old)
+		}
+		if !ok || dist != length {
+			t.Fatalf("TestMinEdits: %v give distance %d, expected %d", edits, dist, length)
+		}
+	}
+}
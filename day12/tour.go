@@ -0,0 +1,238 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Tours over more waypoints than this are not searched exactly, because the
+// search needs 2^n * n states.
+const MaxExactWaypoints = 16
+
+const unreachable = -1
+
+type Waypoint struct {
+	Name string
+	Pos  Pos
+}
+
+type Tour struct {
+	Order  []int
+	Legs   []int
+	Length int
+	Exact  bool
+}
+
+// ParseWaypoints parses a list such as "S;A;3,4;E". Every element is either
+// a single marker letter (S and E included) or x,y coordinates.
+func ParseWaypoints(str string, hmap *HeightMap, start, end Pos) (result []Waypoint, err error) {
+	for _, field := range strings.Split(str, ";") {
+		field = strings.TrimSpace(field)
+		var pos Pos
+		switch {
+		case field == "S":
+			pos = start
+		case field == "E":
+			pos = end
+		case len(field) == 1:
+			var ok bool
+			if pos, ok = hmap.Marker(field[0]); !ok {
+				return nil, fmt.Errorf("unknown marker %q", field)
+			}
+		default:
+			coords := strings.Split(field, ",")
+			if len(coords) != 2 {
+				return nil, fmt.Errorf("invalid waypoint %q", field)
+			}
+			if pos.X, err = strconv.Atoi(strings.TrimSpace(coords[0])); err != nil {
+				return nil, fmt.Errorf("invalid waypoint %q: %v", field, err)
+			}
+			if pos.Y, err = strconv.Atoi(strings.TrimSpace(coords[1])); err != nil {
+				return nil, fmt.Errorf("invalid waypoint %q: %v", field, err)
+			}
+			if pos.X < 0 || pos.X >= hmap.XSize() || pos.Y < 0 || pos.Y >= hmap.YSize() {
+				return nil, fmt.Errorf("waypoint %q is outside of the map", field)
+			}
+		}
+		result = append(result, Waypoint{field, pos})
+	}
+	return
+}
+
+// DefaultWaypoints starts at S, visits the markers in alphabetical order and
+// ends at E.
+func DefaultWaypoints(hmap *HeightMap, start, end Pos) []Waypoint {
+	result := []Waypoint{{"S", start}}
+	for marker := byte('A'); marker <= 'Z'; marker++ {
+		if pos, ok := hmap.Marker(marker); ok {
+			result = append(result, Waypoint{string(marker), pos})
+		}
+	}
+	return append(result, Waypoint{"E", end})
+}
+
+// PairwiseDistances runs a BFS from every waypoint. The result is not
+// symmetric, since climbing is restricted but descending is not.
+func PairwiseDistances(hmap *HeightMap, waypoints []Waypoint) [][]int {
+	result := make([][]int, len(waypoints))
+	for i, from := range waypoints {
+		dmap := MakeDistanceMap(hmap, from.Pos, false)
+		dmap.Fill()
+		result[i] = make([]int, len(waypoints))
+		for j, to := range waypoints {
+			result[i][j] = unreachable
+			if node := dmap.At(to.Pos); node.Calculated {
+				result[i][j] = node.Distance
+			}
+		}
+	}
+	return result
+}
+
+// ShortestTour finds the shortest path that visits every waypoint, optionally
+// starting at the first and ending at the last one. Small tours are solved
+// exactly with the Held-Karp algorithm, larger ones with the nearest
+// neighbour heuristic.
+func ShortestTour(dist [][]int, fixFirst, fixLast bool) (Tour, bool) {
+	if len(dist) > MaxExactWaypoints {
+		return nearestNeighbourTour(dist, fixFirst, fixLast)
+	}
+	return exactTour(dist, fixFirst, fixLast)
+}
+
+func exactTour(dist [][]int, fixFirst, fixLast bool) (result Tour, found bool) {
+	n := len(dist)
+	if n == 0 {
+		return Tour{Exact: true}, true
+	}
+	full := 1<<n - 1
+	last := n - 1
+
+	best := make([][]int, 1<<n)
+	prev := make([][]int, 1<<n)
+	for mask := range best {
+		best[mask] = make([]int, n)
+		prev[mask] = make([]int, n)
+		for j := range best[mask] {
+			best[mask][j] = unreachable
+		}
+	}
+	for i := 0; i < n; i++ {
+		if (fixFirst && i != 0) || (fixLast && i == last && n > 1) {
+			continue
+		}
+		best[1<<i][i] = 0
+		prev[1<<i][i] = -1
+	}
+
+	for mask := 1; mask <= full; mask++ {
+		for j := 0; j < n; j++ {
+			cur := best[mask][j]
+			if cur == unreachable {
+				continue
+			}
+			for k := 0; k < n; k++ {
+				next := mask | 1<<k
+				if mask&(1<<k) != 0 || dist[j][k] == unreachable {
+					continue
+				}
+				if fixLast && k == last && next != full {
+					continue
+				}
+				if old := best[next][k]; old == unreachable || cur+dist[j][k] < old {
+					best[next][k] = cur + dist[j][k]
+					prev[next][k] = j
+				}
+			}
+		}
+	}
+
+	end := -1
+	for j := 0; j < n; j++ {
+		if fixLast && j != last {
+			continue
+		}
+		if best[full][j] != unreachable && (end < 0 || best[full][j] < best[full][end]) {
+			end = j
+		}
+	}
+	if end < 0 {
+		return
+	}
+
+	result.Length = best[full][end]
+	result.Exact = true
+	for mask, j := full, end; j >= 0; {
+		result.Order = append([]int{j}, result.Order...)
+		j, mask = prev[mask][j], mask&^(1<<j)
+	}
+	result.Legs = tourLegs(dist, result.Order)
+	return result, true
+}
+
+func nearestNeighbourTour(dist [][]int, fixFirst, fixLast bool) (result Tour, found bool) {
+	n := len(dist)
+	last := n - 1
+
+	for start := 0; start < n; start++ {
+		if (fixFirst && start != 0) || (fixLast && start == last) {
+			continue
+		}
+		visited := make([]bool, n)
+		visited[start] = true
+		order := []int{start}
+		length := 0
+		for len(order) < n {
+			cur := order[len(order)-1]
+			next := -1
+			for k := 0; k < n; k++ {
+				if visited[k] || dist[cur][k] == unreachable {
+					continue
+				}
+				if fixLast && k == last && len(order) < n-1 {
+					continue
+				}
+				if next < 0 || dist[cur][k] < dist[cur][next] {
+					next = k
+				}
+			}
+			if next < 0 {
+				break
+			}
+			visited[next] = true
+			order = append(order, next)
+			length += dist[cur][next]
+		}
+		if len(order) == n && (!found || length < result.Length) {
+			result = Tour{Order: order, Length: length}
+			found = true
+		}
+	}
+	if found {
+		result.Legs = tourLegs(dist, result.Order)
+	}
+	return
+}
+
+func tourLegs(dist [][]int, order []int) (result []int) {
+	for i := 0; i+1 < len(order); i++ {
+		result = append(result, dist[order[i]][order[i+1]])
+	}
+	return
+}
+
+func (tour *Tour) Print(waypoints []Waypoint) {
+	for i, idx := range tour.Order {
+		wp := waypoints[idx]
+		if i == 0 {
+			fmt.Printf("%s (%d,%d)\n", wp.Name, wp.Pos.X, wp.Pos.Y)
+		} else {
+			fmt.Printf("-> %s (%d,%d): %d\n", wp.Name, wp.Pos.X, wp.Pos.Y, tour.Legs[i-1])
+		}
+	}
+	if !tour.Exact {
+		fmt.Println("(approximate: too many waypoints for an exact search)")
+	}
+	fmt.Println(tour.Length)
+}
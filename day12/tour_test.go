@@ -0,0 +1,71 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func bruteForceTour(dist [][]int, fixFirst, fixLast bool) (best int) {
+	n := len(dist)
+	best = unreachable
+	order := make([]int, 0, n)
+	used := make([]bool, n)
+	var visit func(length int)
+	visit = func(length int) {
+		if len(order) == n {
+			if fixLast && order[n-1] != n-1 {
+				return
+			}
+			if best == unreachable || length < best {
+				best = length
+			}
+			return
+		}
+		for k := 0; k < n; k++ {
+			if used[k] || (fixFirst && len(order) == 0 && k != 0) {
+				continue
+			}
+			add := 0
+			if len(order) > 0 {
+				if add = dist[order[len(order)-1]][k]; add == unreachable {
+					continue
+				}
+			}
+			used[k] = true
+			order = append(order, k)
+			visit(length + add)
+			order = order[:len(order)-1]
+			used[k] = false
+		}
+	}
+	visit(0)
+	return
+}
+
+func TestExactTour(t *testing.T) {
+	rng := rand.New(rand.NewSource(12))
+	for iter := 0; iter < 200; iter++ {
+		n := 1 + rng.Intn(6)
+		dist := make([][]int, n)
+		for i := range dist {
+			dist[i] = make([]int, n)
+			for j := range dist[i] {
+				if i != j && rng.Intn(4) == 0 {
+					dist[i][j] = unreachable
+				} else if i != j {
+					dist[i][j] = 1 + rng.Intn(20)
+				}
+			}
+		}
+		fixFirst, fixLast := rng.Intn(2) == 0, rng.Intn(2) == 0
+
+		expected := bruteForceTour(dist, fixFirst, fixLast)
+		tour, found := ShortestTour(dist, fixFirst, fixLast)
+		if found != (expected != unreachable) || (found && tour.Length != expected) {
+			t.Fatalf("TestExactTour: %v first=%v last=%v: expected %d, got %d (found %v)", dist, fixFirst, fixLast, expected, tour.Length, found)
+		}
+		if found && len(tour.Order) != n {
+			t.Fatalf("TestExactTour: %v: order %v does not visit every waypoint", dist, tour.Order)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"container/heap"
+)
+
+type CostModel interface {
+	Eligible(from, to Height) bool
+	Cost(from, to Height) int
+	// MinCost is a lower bound for the cost of any move, used by the A*
+	// heuristic.
+	MinCost() int
+}
+
+// ClimbRule limits how far a move may climb or descend and charges a fixed
+// cost per move plus a penalty per unit of height gained or lost. A negative
+// limit means the move is unrestricted in that direction.
+type ClimbRule struct {
+	MaxUp, MaxDown   int
+	StepCost         int
+	UpCost, DownCost int
+}
+
+var DefaultClimbRule = ClimbRule{MaxUp: 1, MaxDown: -1, StepCost: 1}
+
+func (rule ClimbRule) Eligible(from, to Height) bool {
+	diff := int(to) - int(from)
+	if rule.MaxUp >= 0 && diff > rule.MaxUp {
+		return false
+	}
+	if rule.MaxDown >= 0 && -diff > rule.MaxDown {
+		return false
+	}
+	return true
+}
+
+func (rule ClimbRule) Cost(from, to Height) int {
+	diff := int(to) - int(from)
+	if diff > 0 {
+		return rule.StepCost + diff*rule.UpCost
+	}
+	return rule.StepCost - diff*rule.DownCost
+}
+
+func (rule ClimbRule) MinCost() int {
+	return rule.StepCost
+}
+
+type searchItem struct {
+	pos      Pos
+	cost     int
+	priority int
+}
+
+type searchQueue []searchItem
+
+func (queue searchQueue) Len() int {
+	return len(queue)
+}
+
+func (queue searchQueue) Less(i, j int) bool {
+	return queue[i].priority < queue[j].priority
+}
+
+func (queue searchQueue) Swap(i, j int) {
+	queue[i], queue[j] = queue[j], queue[i]
+}
+
+func (queue *searchQueue) Push(item any) {
+	*queue = append(*queue, item.(searchItem))
+}
+
+func (queue *searchQueue) Pop() any {
+	old := *queue
+	item := old[len(old)-1]
+	*queue = old[:len(old)-1]
+	return item
+}
+
+// WeightedSearch finds the cheapest route from any of the sources to the
+// target. Without a heuristic this is Dijkstra's algorithm; with astar set
+// the Manhattan distance scaled by the minimum move cost guides the search.
+func WeightedSearch(hmap *HeightMap, model CostModel, sources []Pos, target Pos, astar bool) (cost int, route []Pos, found bool) {
+	heuristic := func(pos Pos) int {
+		if !astar {
+			return 0
+		}
+		return (Abs(pos.X-target.X) + Abs(pos.Y-target.Y)) * model.MinCost()
+	}
+
+	best := make(map[Pos]int)
+	prev := make(map[Pos]Pos)
+	queue := &searchQueue{}
+	for _, source := range sources {
+		best[source] = 0
+		prev[source] = source
+		heap.Push(queue, searchItem{source, 0, heuristic(source)})
+	}
+
+	for queue.Len() > 0 {
+		item := heap.Pop(queue).(searchItem)
+		if item.cost > best[item.pos] {
+			continue
+		}
+		if item.pos == target {
+			found = true
+			cost = item.cost
+			break
+		}
+
+		from := hmap.At(item.pos)
+		hmap.TraverseNeighbours(item.pos, func(to Pos) {
+			if !model.Eligible(from, hmap.At(to)) {
+				return
+			}
+			cost := item.cost + model.Cost(from, hmap.At(to))
+			if old, ok := best[to]; ok && old <= cost {
+				return
+			}
+			best[to] = cost
+			prev[to] = item.pos
+			heap.Push(queue, searchItem{to, cost, cost + heuristic(to)})
+		})
+	}
+	if !found {
+		return
+	}
+
+	for pos := target; ; pos = prev[pos] {
+		route = append(route, pos)
+		if prev[pos] == pos {
+			break
+		}
+	}
+	for i, j := 0, len(route)-1; i < j; i, j = i+1, j-1 {
+		route[i], route[j] = route[j], route[i]
+	}
+	return
+}
+
+func Abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
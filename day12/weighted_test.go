@@ -0,0 +1,20 @@
+package main
+
+import (
+	"testing"
+)
+
+func AssertWeighted(t *testing.T, hmap *HeightMap, sources []Pos, target Pos, expected int) {
+	for _, astar := range []bool{false, true} {
+		cost, route, found := WeightedSearch(hmap, DefaultClimbRule, sources, target, astar)
+		if !found || cost != expected || len(route) != expected+1 {
+			t.Fatalf("AssertWeighted(t, hmap, %v, %v, %d): astar=%v got %d (found %v)", sources, target, expected, astar, cost, found)
+		}
+	}
+}
+
+func TestWeightedMatchesBfs(t *testing.T) {
+	hmap, start, end := LoadTestMap(t)
+	AssertWeighted(t, &hmap, []Pos{start}, end, 31)
+	AssertWeighted(t, &hmap, hmap.PositionsOfHeight(CharToHeight('a')), end, 29)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+type DecidingRule int
+
+const (
+	RuleNone DecidingRule = iota
+	RuleLeftSmaller
+	RuleRightSmaller
+	RuleLeftRanOut
+	RuleRightRanOut
+)
+
+var ruleDescriptions = map[DecidingRule]string{
+	RuleNone:         "the packets are equal",
+	RuleLeftSmaller:  "Left side is smaller, so inputs are in the right order",
+	RuleRightSmaller: "Right side is smaller, so inputs are not in the right order",
+	RuleLeftRanOut:   "Left side ran out of items, so inputs are in the right order",
+	RuleRightRanOut:  "Right side ran out of items, so inputs are not in the right order",
+}
+
+func (rule DecidingRule) String() string {
+	return ruleDescriptions[rule]
+}
+
+// Wrap records an integer that was converted to a single-item list because
+// the other side was a list.
+type Wrap struct {
+	Path  []int
+	Left  bool
+	Value PacketIntData
+}
+
+type ExplainStep struct {
+	Depth    int
+	Lhs, Rhs PacketData
+	Wrap     *Wrap
+}
+
+// Explanation describes how Compare reached its result: the indexes leading
+// to the deciding element, the values compared there and the rule applied.
+// If a list ran out, the values are the two lists.
+type Explanation struct {
+	Result   int
+	Path     []int
+	Lhs, Rhs PacketData
+	Rule     DecidingRule
+	Wraps    []Wrap
+	Steps    []ExplainStep
+	depth    int
+}
+
+func Explain(lhs, rhs PacketData) (result Explanation) {
+	result.Result = result.explain(lhs, rhs, []int{}, 0)
+	return
+}
+
+func (exp *Explanation) decide(lhs, rhs PacketData, path []int, depth int, rule DecidingRule, result int) int {
+	exp.Lhs, exp.Rhs = lhs, rhs
+	exp.Path = append([]int{}, path...)
+	exp.Rule = rule
+	exp.depth = depth
+	return result
+}
+
+func (exp *Explanation) explain(lhs, rhs PacketData, path []int, depth int) int {
+	exp.Steps = append(exp.Steps, ExplainStep{Depth: depth, Lhs: lhs, Rhs: rhs})
+
+	if lhs.IsInt() && rhs.IsInt() {
+		switch lhs.AsInt().Cmp(rhs.AsInt()) {
+		case -1:
+			return exp.decide(lhs, rhs, path, depth, RuleLeftSmaller, -1)
+		case 1:
+			return exp.decide(lhs, rhs, path, depth, RuleRightSmaller, 1)
+		}
+		return 0
+	}
+
+	if lhs.IsInt() || rhs.IsInt() {
+		wrap := Wrap{Path: append([]int{}, path...), Left: lhs.IsInt()}
+		if wrap.Left {
+			wrap.Value = lhs.AsInt()
+			lhs = PacketListData{lhs}
+		} else {
+			wrap.Value = rhs.AsInt()
+			rhs = PacketListData{rhs}
+		}
+		exp.Wraps = append(exp.Wraps, wrap)
+		exp.Steps[len(exp.Steps)-1].Wrap = &exp.Wraps[len(exp.Wraps)-1]
+		depth++
+		exp.Steps = append(exp.Steps, ExplainStep{Depth: depth, Lhs: lhs, Rhs: rhs})
+	}
+
+	l, r := lhs.AsList(), rhs.AsList()
+	for i := 0; i < len(l) && i < len(r); i++ {
+		if result := exp.explain(l[i], r[i], append(path, i), depth+1); result != 0 {
+			return result
+		}
+	}
+	switch {
+	case len(l) < len(r):
+		return exp.decide(lhs, rhs, path, depth, RuleLeftRanOut, -1)
+	case len(l) > len(r):
+		return exp.decide(lhs, rhs, path, depth, RuleRightRanOut, 1)
+	}
+	return 0
+}
+
+// Narrate prints the comparison the way the puzzle statement does.
+func (exp *Explanation) Narrate(out io.Writer) {
+	for _, step := range exp.Steps {
+		indent := strings.Repeat("  ", step.Depth)
+		fmt.Fprintf(out, "%s- Compare %v vs %v\n", indent, step.Lhs, step.Rhs)
+		if step.Wrap != nil {
+			side, value := "right", step.Rhs
+			if step.Wrap.Left {
+				side, value = "left", step.Lhs
+			}
+			fmt.Fprintf(out, "%s  - Mixed types; convert %s to [%v] and retry comparison\n", indent, side, value)
+		}
+	}
+	if exp.Rule != RuleNone {
+		fmt.Fprintf(out, "%s- %v\n", strings.Repeat("  ", exp.depth+1), exp.Rule)
+	}
+}
+
+func (exp *Explanation) Summary() string {
+	if exp.Rule == RuleNone {
+		return exp.Rule.String()
+	}
+	result := fmt.Sprintf("decided at path %v comparing %v with %v", exp.Path, exp.Lhs, exp.Rhs)
+	for _, wrap := range exp.Wraps {
+		side := "right"
+		if wrap.Left {
+			side = "left"
+		}
+		result += fmt.Sprintf("; wrapped %s integer %v at path %v", side, wrap.Value, wrap.Path)
+	}
+	return result
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestExplainMatchesCompare(t *testing.T) {
+	f, err := os.Open("test_input")
+	if err != nil {
+		t.Fatalf("TestExplainMatchesCompare: %v", err)
+	}
+	defer f.Close()
+
+	reader := NewPacketReader(f)
+	for {
+		left, right, err := reader.ReadPair()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("TestExplainMatchesCompare: %v", err)
+		}
+		for _, pair := range [][2]PacketData{{left, right}, {right, left}} {
+			exp := Explain(pair[0], pair[1])
+			if exp.Result != Compare(pair[0], pair[1]) {
+				t.Fatalf("TestExplainMatchesCompare: %v vs %v: Explain gives %d", pair[0], pair[1], exp.Result)
+			}
+		}
+	}
+}
+
+func TestExplainPath(t *testing.T) {
+	lhs, _ := NewPacketReader(strings.NewReader("[[1],[2,3,4]]")).ReadPacket()
+	rhs, _ := NewPacketReader(strings.NewReader("[[1],4]")).ReadPacket()
+	exp := Explain(lhs, rhs)
+	if fmt.Sprint(exp.Path) != "[1 0]" || exp.Rule != RuleLeftSmaller || len(exp.Wraps) != 1 || exp.Wraps[0].Left {
+		t.Fatalf("TestExplainPath: got %s", exp.Summary())
+	}
+}
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+
+	"golang.org/x/exp/slices"
+)
+
+// Binary encoding of packets: a tag byte followed by a uvarint item count and
+// the items for lists, a varint for integers that fit into an int64, or a
+// uvarint length and the big-endian magnitude for larger integers, with a
+// separate tag for negative ones.
+const (
+	tagList byte = iota
+	tagInt
+	tagBigInt
+	tagNegBigInt
+)
+
+// MaxMergeFanIn limits the number of runs merged at once, and with it the
+// number of files open at the same time.
+const MaxMergeFanIn = 64
+
+func EncodePacket(w *bufio.Writer, packet PacketData) error {
+	var buf [binary.MaxVarintLen64]byte
+	if packet.IsList() {
+		w.WriteByte(tagList)
+		w.Write(buf[:binary.PutUvarint(buf[:], uint64(len(packet.AsList())))])
+		for _, item := range packet.AsList() {
+			if err := EncodePacket(w, item); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	value := packet.AsInt()
+	if value.big == nil {
+		w.WriteByte(tagInt)
+		_, err := w.Write(buf[:binary.PutVarint(buf[:], value.small)])
+		return err
+	}
+	tag := tagBigInt
+	if value.big.Sign() < 0 {
+		tag = tagNegBigInt
+	}
+	bytes := value.big.Bytes()
+	w.WriteByte(tag)
+	w.Write(buf[:binary.PutUvarint(buf[:], uint64(len(bytes)))])
+	_, err := w.Write(bytes)
+	return err
+}
+
+// DecodePacket reads a packet written by EncodePacket. It returns io.EOF if
+// the input ends before the packet starts.
+func DecodePacket(r *bufio.Reader) (PacketData, error) {
+	tag, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	unexpected := func(err error) error {
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		}
+		return err
+	}
+
+	switch tag {
+	case tagList:
+		count, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, unexpected(err)
+		}
+		result := make(PacketListData, 0, count)
+		for i := uint64(0); i < count; i++ {
+			item, err := DecodePacket(r)
+			if err != nil {
+				return nil, unexpected(err)
+			}
+			result = append(result, item)
+		}
+		return result, nil
+	case tagInt:
+		value, err := binary.ReadVarint(r)
+		if err != nil {
+			return nil, unexpected(err)
+		}
+		return MakePacketInt(value), nil
+	case tagBigInt, tagNegBigInt:
+		size, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, unexpected(err)
+		}
+		bytes := make([]byte, size)
+		if _, err := io.ReadFull(r, bytes); err != nil {
+			return nil, unexpected(err)
+		}
+		value := new(big.Int).SetBytes(bytes)
+		if tag == tagNegBigInt {
+			value.Neg(value)
+		}
+		return MakeBigPacketInt(value), nil
+	}
+	return nil, fmt.Errorf("invalid packet tag %d", tag)
+}
+
+// PacketMemory estimates how many bytes a decoded packet occupies.
+func PacketMemory(packet PacketData) int {
+	if packet.IsInt() {
+		if packet.AsInt().big != nil {
+			return 48 + len(packet.AsInt().big.Bits())*8
+		}
+		return 32
+	}
+	result := 40
+	for _, item := range packet.AsList() {
+		result += PacketMemory(item)
+	}
+	return result
+}
+
+type runFile struct {
+	path string
+}
+
+type ExternalSorter struct {
+	tempDir string
+	budget  int
+	runs    []runFile
+}
+
+func NewExternalSorter(tempDir string, budget int) (result *ExternalSorter) {
+	result = new(ExternalSorter)
+	result.tempDir = tempDir
+	result.budget = budget
+	return
+}
+
+func (sorter *ExternalSorter) writeRun(packets []PacketData) (err error) {
+	f, err := os.CreateTemp(sorter.tempDir, "day13-run-*")
+	if err != nil {
+		return
+	}
+	sorter.runs = append(sorter.runs, runFile{f.Name()})
+
+	w := bufio.NewWriter(f)
+	for _, packet := range packets {
+		if err = EncodePacket(w, packet); err != nil {
+			f.Close()
+			return
+		}
+	}
+	if err = w.Flush(); err != nil {
+		f.Close()
+		return
+	}
+	return f.Close()
+}
+
+// SpillRuns reads all packets and writes them out as sorted runs, each of
+// which fits into the memory budget.
+func (sorter *ExternalSorter) SpillRuns(reader *PacketReader) error {
+	run := PacketListData{}
+	used := 0
+	for {
+		packet, err := reader.NextPacket()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		run = append(run, packet)
+		used += PacketMemory(packet)
+		if used >= sorter.budget {
+			SortPackets(run)
+			if err := sorter.writeRun(run); err != nil {
+				return err
+			}
+			run = PacketListData{}
+			used = 0
+		}
+	}
+	if len(run) > 0 {
+		SortPackets(run)
+		return sorter.writeRun(run)
+	}
+	return nil
+}
+
+func (sorter *ExternalSorter) Cleanup() {
+	for _, run := range sorter.runs {
+		os.Remove(run.path)
+	}
+	sorter.runs = nil
+}
+
+type mergeSource struct {
+	next   PacketData
+	order  int
+	reader *bufio.Reader
+	memory []PacketData
+}
+
+func (source *mergeSource) advance() (bool, error) {
+	if source.reader == nil {
+		if len(source.memory) == 0 {
+			return false, nil
+		}
+		source.next, source.memory = source.memory[0], source.memory[1:]
+		return true, nil
+	}
+
+	packet, err := DecodePacket(source.reader)
+	if err == io.EOF {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	source.next = packet
+	return true, nil
+}
+
+// mergeHeap orders sources by their next packet and, for equal packets, by
+// the order of the sources, which keeps the merge stable.
+type mergeHeap []*mergeSource
+
+func (h mergeHeap) Len() int {
+	return len(h)
+}
+
+func (h mergeHeap) Less(i, j int) bool {
+	if c := Compare(h[i].next, h[j].next); c != 0 {
+		return c < 0
+	}
+	return h[i].order < h[j].order
+}
+
+func (h mergeHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+}
+
+func (h *mergeHeap) Push(item any) {
+	*h = append(*h, item.(*mergeSource))
+}
+
+func (h *mergeHeap) Pop() any {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
+
+// merge merges the given runs and the packets in memory, which come first
+// among equal packets, and passes every packet to emit along with the index
+// of its source: -1 for memory, otherwise the index in runs.
+func merge(runs []runFile, memory []PacketData, emit func(packet PacketData, source int) error) (err error) {
+	h := &mergeHeap{}
+	sources := []*mergeSource{{order: -1, memory: memory}}
+	for i, run := range runs {
+		f, err := os.Open(run.path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		sources = append(sources, &mergeSource{order: i, reader: bufio.NewReader(f)})
+	}
+	for _, source := range sources {
+		ok, err := source.advance()
+		if err != nil {
+			return err
+		}
+		if ok {
+			heap.Push(h, source)
+		}
+	}
+
+	for h.Len() > 0 {
+		source := (*h)[0]
+		if err = emit(source.next, source.order); err != nil {
+			return
+		}
+		ok, err := source.advance()
+		if err != nil {
+			return err
+		}
+		if ok {
+			heap.Fix(h, 0)
+		} else {
+			heap.Pop(h)
+		}
+	}
+	return nil
+}
+
+func (sorter *ExternalSorter) mergeGroup(group []runFile) (merged runFile, err error) {
+	f, err := os.CreateTemp(sorter.tempDir, "day13-run-*")
+	if err != nil {
+		return
+	}
+	merged.path = f.Name()
+	w := bufio.NewWriter(f)
+	err = merge(group, nil, func(packet PacketData, source int) error {
+		return EncodePacket(w, packet)
+	})
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	for _, run := range group {
+		os.Remove(run.path)
+	}
+	return
+}
+
+// reduceRuns merges neighbouring runs in groups until at most MaxMergeFanIn
+// remain. Merging neighbours keeps the input order among equal packets.
+func (sorter *ExternalSorter) reduceRuns() error {
+	for len(sorter.runs) > MaxMergeFanIn {
+		reduced := []runFile{}
+		for start := 0; start < len(sorter.runs); start += MaxMergeFanIn {
+			end := start + MaxMergeFanIn
+			if end > len(sorter.runs) {
+				end = len(sorter.runs)
+			}
+			merged, err := sorter.mergeGroup(sorter.runs[start:end])
+			reduced = append(reduced, merged)
+			if err != nil {
+				sorter.runs = append(reduced, sorter.runs[end:]...)
+				return err
+			}
+		}
+		sorter.runs = reduced
+	}
+	return nil
+}
+
+// Merge emits all spilled packets together with the dividers in Compare
+// order. It returns the 1-based position of every divider in the merged
+// sequence, in the order the dividers were given.
+func (sorter *ExternalSorter) Merge(dividers []PacketData, emit func(PacketData) error) (positions []int, err error) {
+	if err = sorter.reduceRuns(); err != nil {
+		return
+	}
+
+	sorted := make([]int, len(dividers))
+	for i := range sorted {
+		sorted[i] = i
+	}
+	slices.SortStableFunc(sorted, func(i, j int) bool {
+		return Compare(dividers[i], dividers[j]) == -1
+	})
+	memory := make([]PacketData, len(dividers))
+	for i, idx := range sorted {
+		memory[i] = dividers[idx]
+	}
+
+	positions = make([]int, len(dividers))
+	position, nextDivider := 0, 0
+	err = merge(sorter.runs, memory, func(packet PacketData, source int) error {
+		position++
+		if source < 0 {
+			positions[sorted[nextDivider]] = position
+			nextDivider++
+		}
+		if emit != nil {
+			return emit(packet)
+		}
+		return nil
+	})
+	return
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func randomPacket(rng *rand.Rand, depth int) PacketData {
+	if depth > 0 && (depth > 3 || rng.Intn(3) == 0) {
+		if rng.Intn(10) == 0 {
+			value, _ := UnmarshalPacket([]byte(fmt.Sprintf("%d%020d", rng.Intn(100), rng.Int63())))
+			return value
+		}
+		return MakePacketInt(int64(rng.Intn(10)))
+	}
+	result := PacketListData{}
+	for i := rng.Intn(4); i > 0; i-- {
+		result = append(result, randomPacket(rng, depth+1))
+	}
+	return result
+}
+
+func TestEncoding(t *testing.T) {
+	rng := rand.New(rand.NewSource(5))
+	var buf bytes.Buffer
+	w := bufio.NewWriter(&buf)
+	packets := []PacketData{}
+	for i := 0; i < 100; i++ {
+		packets = append(packets, randomPacket(rng, 0))
+		EncodePacket(w, packets[i])
+	}
+	negative, _ := UnmarshalPacket([]byte("[-5,-123456789012345678901234567890]"))
+	packets = append(packets, negative)
+	EncodePacket(w, negative)
+	w.Flush()
+
+	r := bufio.NewReader(&buf)
+	for _, expected := range packets {
+		got, err := DecodePacket(r)
+		if err != nil || got.String() != expected.String() {
+			t.Fatalf("TestEncoding: expected %v, got %v, err %v", expected, got, err)
+		}
+	}
+}
+
+func TestExternalSort(t *testing.T) {
+	rng := rand.New(rand.NewSource(7))
+	var input strings.Builder
+	packets := PacketListData{}
+	for i := 0; i < 3*MaxMergeFanIn; i++ {
+		packet := randomPacket(rng, 0)
+		packets = append(packets, packet)
+		fmt.Fprintln(&input, packet)
+	}
+	dividers := []PacketData{
+		PacketListData{PacketListData{MakePacketInt(6)}},
+		PacketListData{PacketListData{MakePacketInt(2)}},
+	}
+
+	sorter := NewExternalSorter(t.TempDir(), 0)
+	defer sorter.Cleanup()
+	if err := sorter.SpillRuns(NewPacketReader(strings.NewReader(input.String()))); err != nil {
+		t.Fatalf("TestExternalSort: %v", err)
+	}
+	got := []string{}
+	positions, err := sorter.Merge(dividers, func(packet PacketData) error {
+		got = append(got, packet.String())
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("TestExternalSort: %v", err)
+	}
+
+	expected := append(PacketListData{}, dividers...)
+	expected = append(expected, packets...)
+	SortPackets(expected)
+	for i := range expected {
+		if got[i] != expected[i].String() {
+			t.Fatalf("TestExternalSort: packet %d is %v instead of %v", i, got[i], expected[i])
+		}
+	}
+	for i, divider := range dividers {
+		if Compare(expected[positions[i]-1], divider) != 0 {
+			t.Fatalf("TestExternalSort: divider %v reported at %d", divider, positions[i])
+		}
+	}
+}
@@ -2,10 +2,13 @@ package main
 
 import (
 	"bufio"
-	"encoding/json"
+	"flag"
 	"fmt"
-	"math"
+	"io"
+	"math/big"
 	"os"
+	"strconv"
+	"strings"
 
 	"golang.org/x/exp/slices"
 )
@@ -15,9 +18,17 @@ type PacketData interface {
 	IsList() bool
 	AsInt() PacketIntData
 	AsList() PacketListData
+	String() string
+	MarshalText() ([]byte, error)
+}
+
+// PacketIntData holds an integer of any size. Values that fit into an int64
+// are kept in small, the others in big.
+type PacketIntData struct {
+	small int64
+	big   *big.Int
 }
 
-type PacketIntData int
 type PacketListData []PacketData
 
 func (PacketIntData) IsInt() bool {
@@ -32,6 +43,44 @@ func (d PacketIntData) AsInt() PacketIntData {
 	return d
 }
 
+func MakePacketInt(value int64) PacketIntData {
+	return PacketIntData{small: value}
+}
+
+func MakeBigPacketInt(value *big.Int) PacketIntData {
+	if value.IsInt64() {
+		return PacketIntData{small: value.Int64()}
+	}
+	return PacketIntData{big: value}
+}
+
+func (d PacketIntData) Big() *big.Int {
+	if d.big != nil {
+		return d.big
+	}
+	return big.NewInt(d.small)
+}
+
+func (d PacketIntData) Cmp(other PacketIntData) int {
+	if d.big == nil && other.big == nil {
+		switch {
+		case d.small < other.small:
+			return -1
+		case d.small > other.small:
+			return 1
+		}
+		return 0
+	}
+	return d.Big().Cmp(other.Big())
+}
+
+func (d PacketIntData) String() string {
+	if d.big != nil {
+		return d.big.String()
+	}
+	return strconv.FormatInt(d.small, 10)
+}
+
 func (PacketIntData) AsList() PacketListData {
 	panic("Not a list")
 }
@@ -52,16 +101,23 @@ func (d PacketListData) AsList() PacketListData {
 	return d
 }
 
+func (d PacketListData) String() string {
+	var sb strings.Builder
+	sb.WriteByte('[')
+	for i, item := range d {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(item.String())
+	}
+	sb.WriteByte(']')
+	return sb.String()
+}
+
 func Compare(lhs, rhs PacketData) int {
 	//fmt.Printf("Compare %v, %v\n", lhs, rhs)
 	if lhs.IsInt() && rhs.IsInt() {
-		if lhs.AsInt() < rhs.AsInt() {
-			return -1
-		} else if lhs.AsInt() == rhs.AsInt() {
-			return 0
-		} else {
-			return 1
-		}
+		return lhs.AsInt().Cmp(rhs.AsInt())
 	} else if lhs.IsList() && rhs.IsList() {
 		return slices.CompareFunc(lhs.AsList(), rhs.AsList(), Compare)
 	} else {
@@ -74,66 +130,35 @@ func Compare(lhs, rhs PacketData) int {
 	}
 }
 
-func convertRawPacket(data any) PacketData {
-	switch d := data.(type) {
-	case float64:
-		if d != math.Trunc(d) {
-			panic("Integer expected")
-		}
-		return PacketIntData(d)
-	case []any:
-		result := []PacketData{}
-		for _, item := range d {
-			result = append(result, convertRawPacket(item))
-		}
-		return PacketListData(result)
-	}
-
-	panic(fmt.Sprintf("Unrecognized type: %T", data))
-}
-
-func ParsePacket(scanner *bufio.Scanner) (ok bool, result PacketListData) {
-	ok = scanner.Scan()
-	if !ok {
+func ReadPacketPair(reader *PacketReader) (ok bool, left PacketData, right PacketData) {
+	l, r, err := reader.ReadPair()
+	if err == io.EOF {
 		return
 	}
-	var j any
-	err := json.Unmarshal([]byte(scanner.Text()), &j)
 	if err != nil {
 		panic(err)
 	}
-	result = convertRawPacket(j).(PacketListData)
-	return
+	return true, l, r
 }
 
-func ParsePacketPair(scanner *bufio.Scanner) (ok bool, left PacketData, right PacketData) {
-	ok, left = ParsePacket(scanner)
-	if !ok {
-		return
-	}
-	ok, right = ParsePacket(scanner)
-	if !ok {
-		panic("Second packet expected")
-	}
-	if scanner.Scan() {
-		if scanner.Text() != "" {
-			panic("Empty line expected")
-		}
-	}
-	return
-}
-
-func mode1() {
-	scanner := bufio.NewScanner(os.Stdin)
+func mode1(explain bool) {
+	reader := NewPacketReader(os.Stdin)
 	index := 0
 	sum := 0
 	for {
 		index++
-		ok, left, right := ParsePacketPair(scanner)
+		ok, left, right := ReadPacketPair(reader)
 		if !ok {
 			break
 		}
 
+		if explain {
+			exp := Explain(left, right)
+			fmt.Printf("== Pair %d ==\n", index)
+			exp.Narrate(os.Stdout)
+			fmt.Printf("(%s)\n\n", exp.Summary())
+		}
+
 		if Compare(left, right) == -1 {
 			sum += index
 		}
@@ -141,45 +166,166 @@ func mode1() {
 	fmt.Println(sum)
 }
 
-func mode2() {
-	scanner := bufio.NewScanner(os.Stdin)
-	divider2 := PacketData(PacketListData{PacketListData{PacketIntData(2)}})
-	divider6 := PacketData(PacketListData{PacketListData{PacketIntData(6)}})
-	packets := PacketListData{divider2, divider6}
+type packetListFlag []PacketData
 
+func (f *packetListFlag) String() string {
+	items := []string{}
+	for _, packet := range *f {
+		items = append(items, packet.String())
+	}
+	return strings.Join(items, " ")
+}
+
+func (f *packetListFlag) Set(value string) error {
+	packet, err := UnmarshalPacket([]byte(value))
+	if err == nil {
+		*f = append(*f, packet)
+	}
+	return err
+}
+
+func ReadAllPackets(reader *PacketReader) (result PacketListData) {
 	for {
-		ok, left, right := ParsePacketPair(scanner)
-		if !ok {
-			break
+		packet, err := reader.NextPacket()
+		if err == io.EOF {
+			return
 		}
-
-		packets = append(packets, left, right)
+		if err != nil {
+			panic(err)
+		}
+		result = append(result, packet)
 	}
+}
 
+func SortPackets(packets PacketListData) {
 	slices.SortStableFunc(packets, func(lhs, rhs PacketData) bool {
 		return Compare(lhs, rhs) == -1
 	})
+}
 
-	d2idx, d2ok := slices.BinarySearchFunc(packets, divider2, Compare)
-	if !d2ok {
-		panic("Divider packet [[2]] not found")
+func externalSort(dividers []PacketData, memory int, tempDir string, emit func(PacketData) error) []int {
+	sorter := NewExternalSorter(tempDir, memory)
+	defer sorter.Cleanup()
+	if err := sorter.SpillRuns(NewPacketReader(os.Stdin)); err != nil {
+		panic(err)
+	}
+	positions, err := sorter.Merge(dividers, emit)
+	if err != nil {
+		panic(err)
+	}
+	return positions
+}
+
+func mode2External(dividers []PacketData, memory int, tempDir string) {
+	key := 1
+	for _, position := range externalSort(dividers, memory, tempDir, nil) {
+		key *= position
+	}
+	fmt.Println(key)
+}
+
+func modeSortExternal(pretty, memory int, tempDir string) {
+	w := bufio.NewWriter(os.Stdout)
+	defer w.Flush()
+	externalSort(nil, memory, tempDir, func(packet PacketData) error {
+		if pretty > 0 {
+			_, err := fmt.Fprintln(w, FormatPretty(packet, pretty))
+			return err
+		}
+		_, err := fmt.Fprintln(w, packet)
+		return err
+	})
+}
+
+func mode2(dividers []PacketData) {
+	packets := ReadAllPackets(NewPacketReader(os.Stdin))
+	packets = append(packets, dividers...)
+	SortPackets(packets)
+
+	key := 1
+	for _, divider := range dividers {
+		idx, ok := slices.BinarySearchFunc(packets, divider, Compare)
+		if !ok {
+			panic(fmt.Sprintf("Divider packet %v not found", divider))
+		}
+		key *= idx + 1
 	}
 
-	d6idx, d6ok := slices.BinarySearchFunc(packets[d2idx:], divider6, Compare)
-	if !d6ok {
-		panic("Divider packet [[6]] not found")
+	fmt.Println(key)
+}
+
+func modeSort(pretty int) {
+	packets := ReadAllPackets(NewPacketReader(os.Stdin))
+	SortPackets(packets)
+	for _, packet := range packets {
+		if pretty > 0 {
+			fmt.Println(FormatPretty(packet, pretty))
+		} else {
+			fmt.Println(packet)
+		}
 	}
+}
 
-	d2idx++
-	d6idx += d2idx
+func modeGrep(query string, pretty int) {
+	q, err := ParseQuery(query)
+	if err != nil {
+		panic(fmt.Sprintf("Invalid query %q: %v", query, err))
+	}
 
-	fmt.Println(d2idx * d6idx)
+	reader := NewPacketReader(os.Stdin)
+	w := bufio.NewWriter(os.Stdout)
+	defer w.Flush()
+	for index := 1; ; index++ {
+		packet, err := reader.NextPacket()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			panic(err)
+		}
+		if !q.Match(packet) {
+			continue
+		}
+		if pretty > 0 {
+			fmt.Fprintf(w, "%d: %s\n", index, FormatPretty(packet, pretty))
+		} else {
+			fmt.Fprintf(w, "%d: %v\n", index, packet)
+		}
+	}
 }
 
 func main() {
-	if (len(os.Args) > 1) && (os.Args[1] == "2") {
-		mode2()
-	} else {
-		mode1()
+	explain := flag.Bool("explain", false, "print how every pair was compared in part 1")
+	pretty := flag.Int("pretty", 0, "pretty-print sorted packets wider than this many characters")
+	external := flag.Bool("external", false, "sort in part 2 and sort mode with sorted runs spilled to temporary files")
+	memoryMb := flag.Int("memory", 256, "approximate memory limit in MiB for the packets of a run when sorting externally")
+	tempDir := flag.String("tmpdir", "", "directory for the runs of the external sort (default the system temporary directory)")
+	var dividers packetListFlag
+	flag.Var(&dividers, "divider", "divider packet for part 2, may be repeated (default [[2]] and [[6]])")
+	flag.Parse()
+
+	if len(dividers) == 0 {
+		dividers = packetListFlag{
+			PacketListData{PacketListData{MakePacketInt(2)}},
+			PacketListData{PacketListData{MakePacketInt(6)}},
+		}
+	}
+
+	switch flag.Arg(0) {
+	case "2":
+		if *external {
+			mode2External(dividers, *memoryMb<<20, *tempDir)
+		} else {
+			mode2(dividers)
+		}
+	case "grep":
+		modeGrep(flag.Arg(1), *pretty)
+	case "sort":
+		if *external {
+			modeSortExternal(*pretty, *memoryMb<<20, *tempDir)
+		} else {
+			modeSort(*pretty)
+		}
+	default:
+		mode1(*explain)
 	}
 }
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math/big"
+)
+
+type ParseError struct {
+	Line, Column int
+	Msg          string
+}
+
+func (err *ParseError) Error() string {
+	return fmt.Sprintf("line %d, column %d: %s", err.Line, err.Column, err.Msg)
+}
+
+// PacketReader parses packets straight from a stream, one packet per line,
+// with pairs of packets separated by blank lines.
+type PacketReader struct {
+	in           *bufio.Reader
+	line, column int
+	prevColumn   int
+	// multiline lets a packet span several lines.
+	multiline bool
+}
+
+// Integers with at most this many digits always fit into an int64.
+const maxSmallDigits = 18
+
+func NewPacketReader(in io.Reader) (result *PacketReader) {
+	result = new(PacketReader)
+	result.in = bufio.NewReader(in)
+	result.line = 1
+	return
+}
+
+func (reader *PacketReader) errorf(format string, args ...any) error {
+	return &ParseError{reader.line, reader.column + 1, fmt.Sprintf(format, args...)}
+}
+
+func (reader *PacketReader) read() (byte, bool) {
+	c, err := reader.in.ReadByte()
+	if err != nil {
+		return 0, false
+	}
+	reader.prevColumn = reader.column
+	if c == '\n' {
+		reader.line++
+		reader.column = 0
+	} else {
+		reader.column++
+	}
+	return c, true
+}
+
+func (reader *PacketReader) unread(c byte) {
+	reader.in.UnreadByte()
+	if c == '\n' {
+		reader.line--
+	}
+	reader.column = reader.prevColumn
+}
+
+func (reader *PacketReader) peek() (byte, bool) {
+	c, ok := reader.read()
+	if ok {
+		reader.unread(c)
+	}
+	return c, ok
+}
+
+func (reader *PacketReader) skipSpaces() {
+	for {
+		c, ok := reader.peek()
+		if !ok || (c != ' ' && c != '\t' && c != '\r' && (c != '\n' || !reader.multiline)) {
+			return
+		}
+		reader.read()
+	}
+}
+
+func describe(c byte, ok bool) string {
+	switch {
+	case !ok:
+		return "end of input"
+	case c == '\n':
+		return "end of line"
+	}
+	return fmt.Sprintf("%q", c)
+}
+
+func (reader *PacketReader) expect(expected byte) error {
+	reader.skipSpaces()
+	c, ok := reader.read()
+	if !ok || c != expected {
+		if ok {
+			reader.unread(c)
+		}
+		return reader.errorf("%q expected, got %s", expected, describe(c, ok))
+	}
+	return nil
+}
+
+func (reader *PacketReader) parseList() (result PacketListData, err error) {
+	if err = reader.expect('['); err != nil {
+		return
+	}
+	result = PacketListData{}
+
+	reader.skipSpaces()
+	if c, ok := reader.peek(); ok && c == ']' {
+		reader.read()
+		return
+	}
+
+	for {
+		var item PacketData
+		if item, err = reader.parseValue(); err != nil {
+			return
+		}
+		result = append(result, item)
+
+		reader.skipSpaces()
+		c, ok := reader.read()
+		switch {
+		case ok && c == ']':
+			return
+		case ok && c == ',':
+			continue
+		}
+		if ok {
+			reader.unread(c)
+		}
+		return nil, reader.errorf("',' or ']' expected, got %s", describe(c, ok))
+	}
+}
+
+func (reader *PacketReader) parseValue() (PacketData, error) {
+	reader.skipSpaces()
+	c, ok := reader.peek()
+	switch {
+	case ok && c == '[':
+		return reader.parseList()
+	case ok && (c == '-' || c >= '0' && c <= '9'):
+		return reader.parseInt()
+	}
+	return nil, reader.errorf("value expected, got %s", describe(c, ok))
+}
+
+func (reader *PacketReader) parseInt() (PacketData, error) {
+	negative := false
+	if c, ok := reader.peek(); ok && c == '-' {
+		reader.read()
+		negative = true
+	}
+	digits := []byte{}
+	for {
+		c, ok := reader.peek()
+		if !ok || c < '0' || c > '9' {
+			break
+		}
+		reader.read()
+		digits = append(digits, c)
+	}
+	if len(digits) == 0 {
+		c, ok := reader.peek()
+		return nil, reader.errorf("digit expected, got %s", describe(c, ok))
+	}
+
+	if len(digits) <= maxSmallDigits {
+		value := int64(0)
+		for _, d := range digits {
+			value = value*10 + int64(d-'0')
+		}
+		if negative {
+			value = -value
+		}
+		return MakePacketInt(value), nil
+	}
+	value, _ := new(big.Int).SetString(string(digits), 10)
+	if negative {
+		value.Neg(value)
+	}
+	return MakeBigPacketInt(value), nil
+}
+
+// endLine consumes the rest of the line, which must be blank.
+func (reader *PacketReader) endLine() error {
+	reader.skipSpaces()
+	c, ok := reader.read()
+	if !ok || c == '\n' {
+		return nil
+	}
+	reader.unread(c)
+	return reader.errorf("end of line expected, got %s", describe(c, ok))
+}
+
+// ReadPacket reads the packet on the current line. It returns io.EOF if the
+// input is exhausted.
+func (reader *PacketReader) ReadPacket() (result PacketListData, err error) {
+	if _, ok := reader.peek(); !ok {
+		return nil, io.EOF
+	}
+	if result, err = reader.parseList(); err != nil {
+		return
+	}
+	err = reader.endLine()
+	return
+}
+
+// NextPacket reads the next packet, skipping blank lines. It returns io.EOF
+// if the input is exhausted.
+func (reader *PacketReader) NextPacket() (PacketListData, error) {
+	reader.skipSpaces()
+	for c, ok := reader.peek(); ok && c == '\n'; c, ok = reader.peek() {
+		reader.read()
+		reader.skipSpaces()
+	}
+	return reader.ReadPacket()
+}
+
+// ReadPair reads two packets and the blank line after them, if any. It
+// returns io.EOF if the input is exhausted before the first packet.
+func (reader *PacketReader) ReadPair() (left, right PacketListData, err error) {
+	if left, err = reader.ReadPacket(); err != nil {
+		return
+	}
+	if right, err = reader.ReadPacket(); err == io.EOF {
+		return nil, nil, reader.errorf("second packet expected, got end of input")
+	} else if err != nil {
+		return
+	}
+	if _, ok := reader.peek(); ok {
+		err = reader.endLine()
+	}
+	return
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func AssertParse(t *testing.T, src string, expected string) {
+	packet, err := NewPacketReader(strings.NewReader(src)).ReadPacket()
+	if err != nil {
+		t.Fatalf("AssertParse(t, %q, %q): err %v", src, expected, err)
+	}
+	if got := packet.String(); got != expected {
+		t.Fatalf("AssertParse(t, %q, %q): got %q", src, expected, got)
+	}
+}
+
+func AssertParseErr(t *testing.T, src string, expected string) {
+	reader := NewPacketReader(strings.NewReader(src))
+	var err error
+	for err == nil {
+		_, _, err = reader.ReadPair()
+	}
+	if !strings.Contains(err.Error(), expected) {
+		t.Fatalf("AssertParseErr(t, %q, %q): got %v instead", src, expected, err)
+	}
+}
+
+func TestParse(t *testing.T) {
+	AssertParse(t, "[]", "[]")
+	AssertParse(t, "[1,[2,[3,[4,[5,6,7]]]],8,9]", "[1,[2,[3,[4,[5,6,7]]]],8,9]")
+	AssertParse(t, " [ 1 , [ ] ]\r\n", "[1,[]]")
+	AssertParse(t, "[9007199254740993,123456789012345678901234567890]", "[9007199254740993,123456789012345678901234567890]")
+	AssertParse(t, "[-3,[-0],-123456789012345678901234567890]", "[-3,[0],-123456789012345678901234567890]")
+}
+
+func TestParseErrors(t *testing.T) {
+	AssertParseErr(t, "[1,2\n[3]\n", "line 1, column 5: ',' or ']' expected, got end of line")
+	AssertParseErr(t, "[1]\n[2,]\n", "line 2, column 4: value expected, got ']'")
+	AssertParseErr(t, "[1]\n[2] 3\n", "line 2, column 5: end of line expected")
+	AssertParseErr(t, "[1]\n[2]\n\n1\n", "line 4, column 1: '[' expected, got '1'")
+	AssertParseErr(t, "[1]\n", "second packet expected")
+	AssertParseErr(t, "[1,-]\n", "line 1, column 5: digit expected, got ']'")
+}
+
+func TestCompareBig(t *testing.T) {
+	small := MakePacketInt(1 << 62)
+	large := MakeBigPacketInt(new(big.Int).Lsh(big.NewInt(1), 70))
+	if Compare(small, large) != -1 || Compare(large, small) != 1 || Compare(large, large) != 0 {
+		t.Fatalf("TestCompareBig: wrong order of %v and %v", small, large)
+	}
+}
@@ -0,0 +1,428 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// A query selects nodes of a packet with a path and tests them:
+//
+//	query    := and ('or' and)*
+//	and      := unary ('and' unary)*
+//	unary    := 'not' unary | '(' query ')' | test
+//	test     := selector [('==' | '!=' | '<' | '<=' | '>' | '>=') packet | 'is' kind]
+//	selector := path | 'len' '(' path ')' | 'depth' '(' path ')'
+//	path     := '.' | step ('/' step)*
+//	step     := index | '*' | '**' | '@' depth
+//	kind     := 'int' | 'list' | 'empty'
+//
+// A path starts at the packet itself, at depth 0. An index selects an item
+// of a list, counting from the end if negative, '*' selects every item, '**'
+// the node and all its descendants and '@N' the node and its descendants at
+// depth N. A test holds if any selected node passes it; without a comparison
+// it only requires the path to select something. Comparisons use the packet
+// order, len is the number of items of a list and depth its nesting depth.
+//
+// Examples: "@3 == 7", "0 is empty", "depth(.) >= 4", "not ** == 10".
+type Query interface {
+	Match(packet PacketData) bool
+}
+
+type stepKind int
+
+const (
+	stepIndex stepKind = iota
+	stepChildren
+	stepDescendants
+	stepDepth
+)
+
+type pathStep struct {
+	kind  stepKind
+	value int
+}
+
+type queryNode struct {
+	packet PacketData
+	depth  int
+}
+
+type queryTest struct {
+	path  []pathStep
+	fn    string
+	op    string
+	value PacketData
+	kind  string
+}
+
+type queryOr []Query
+type queryAnd []Query
+type queryNot struct {
+	inner Query
+}
+
+func (query queryOr) Match(packet PacketData) bool {
+	for _, q := range query {
+		if q.Match(packet) {
+			return true
+		}
+	}
+	return false
+}
+
+func (query queryAnd) Match(packet PacketData) bool {
+	for _, q := range query {
+		if !q.Match(packet) {
+			return false
+		}
+	}
+	return true
+}
+
+func (query queryNot) Match(packet PacketData) bool {
+	return !query.inner.Match(packet)
+}
+
+func descendants(node queryNode, cb func(queryNode)) {
+	cb(node)
+	if node.packet.IsList() {
+		for _, item := range node.packet.AsList() {
+			descendants(queryNode{item, node.depth + 1}, cb)
+		}
+	}
+}
+
+func (step pathStep) apply(nodes []queryNode) (result []queryNode) {
+	for _, node := range nodes {
+		switch step.kind {
+		case stepIndex:
+			if !node.packet.IsList() {
+				continue
+			}
+			list := node.packet.AsList()
+			i := step.value
+			if i < 0 {
+				i += len(list)
+			}
+			if i >= 0 && i < len(list) {
+				result = append(result, queryNode{list[i], node.depth + 1})
+			}
+		case stepChildren:
+			if node.packet.IsList() {
+				for _, item := range node.packet.AsList() {
+					result = append(result, queryNode{item, node.depth + 1})
+				}
+			}
+		case stepDescendants, stepDepth:
+			descendants(node, func(n queryNode) {
+				if step.kind == stepDescendants || n.depth == step.value {
+					result = append(result, n)
+				}
+			})
+		}
+	}
+	return
+}
+
+func NestingDepth(packet PacketData) int {
+	if packet.IsInt() {
+		return 0
+	}
+	result := 1
+	for _, item := range packet.AsList() {
+		if depth := NestingDepth(item) + 1; depth > result {
+			result = depth
+		}
+	}
+	return result
+}
+
+func (test *queryTest) check(packet PacketData) bool {
+	switch test.fn {
+	case "len":
+		if !packet.IsList() {
+			return false
+		}
+		packet = MakePacketInt(int64(len(packet.AsList())))
+	case "depth":
+		packet = MakePacketInt(int64(NestingDepth(packet)))
+	}
+
+	switch test.kind {
+	case "int":
+		return packet.IsInt()
+	case "list":
+		return packet.IsList()
+	case "empty":
+		return packet.IsList() && len(packet.AsList()) == 0
+	}
+
+	if test.op == "" {
+		return true
+	}
+	c := Compare(packet, test.value)
+	switch test.op {
+	case "==":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	}
+	panic("Invalid operator")
+}
+
+func (test *queryTest) Match(packet PacketData) bool {
+	nodes := []queryNode{{packet, 0}}
+	for _, step := range test.path {
+		nodes = step.apply(nodes)
+	}
+	for _, node := range nodes {
+		if test.check(node.packet) {
+			return true
+		}
+	}
+	return false
+}
+
+type queryParser struct {
+	src string
+	pos int
+}
+
+func ParseQuery(src string) (result Query, err error) {
+	parser := queryParser{src: src}
+	result, err = parser.parseOr()
+	if err == nil && parser.peek() != "" {
+		err = parser.errorf("unexpected %q", parser.peek())
+	}
+	return
+}
+
+func (parser *queryParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("column %d: %s", parser.pos+1, fmt.Sprintf(format, args...))
+}
+
+func isWordChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-'
+}
+
+// peek returns the next token without consuming it. Packet literals are
+// handled separately by parseValue.
+func (parser *queryParser) peek() string {
+	for parser.pos < len(parser.src) && parser.src[parser.pos] == ' ' {
+		parser.pos++
+	}
+	rest := parser.src[parser.pos:]
+	if rest == "" {
+		return ""
+	}
+	for _, symbol := range []string{"**", "==", "!=", "<=", ">=", "<", ">", "*", "/", "@", "(", ")", ".", "["} {
+		if strings.HasPrefix(rest, symbol) {
+			return symbol
+		}
+	}
+	end := 0
+	for end < len(rest) && isWordChar(rest[end]) {
+		end++
+	}
+	if end == 0 {
+		return rest[:1]
+	}
+	return rest[:end]
+}
+
+func (parser *queryParser) next() string {
+	token := parser.peek()
+	parser.pos += len(token)
+	return token
+}
+
+func (parser *queryParser) expect(token string) error {
+	if parser.peek() != token {
+		return parser.errorf("%q expected", token)
+	}
+	parser.next()
+	return nil
+}
+
+func (parser *queryParser) parseOr() (Query, error) {
+	result := queryOr{}
+	for {
+		q, err := parser.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, q)
+		if parser.peek() != "or" {
+			break
+		}
+		parser.next()
+	}
+	if len(result) == 1 {
+		return result[0], nil
+	}
+	return result, nil
+}
+
+func (parser *queryParser) parseAnd() (Query, error) {
+	result := queryAnd{}
+	for {
+		q, err := parser.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, q)
+		if parser.peek() != "and" {
+			break
+		}
+		parser.next()
+	}
+	if len(result) == 1 {
+		return result[0], nil
+	}
+	return result, nil
+}
+
+func (parser *queryParser) parseUnary() (Query, error) {
+	switch parser.peek() {
+	case "not":
+		parser.next()
+		inner, err := parser.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return queryNot{inner}, nil
+	case "(":
+		parser.next()
+		inner, err := parser.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return inner, parser.expect(")")
+	}
+	return parser.parseTest()
+}
+
+func (parser *queryParser) parseTest() (result *queryTest, err error) {
+	result = new(queryTest)
+	if token := parser.peek(); token == "len" || token == "depth" {
+		result.fn = parser.next()
+		if err = parser.expect("("); err != nil {
+			return
+		}
+		if result.path, err = parser.parsePath(); err != nil {
+			return
+		}
+		err = parser.expect(")")
+	} else {
+		result.path, err = parser.parsePath()
+	}
+	if err != nil {
+		return
+	}
+
+	switch token := parser.peek(); token {
+	case "==", "!=", "<", "<=", ">", ">=":
+		result.op = parser.next()
+		result.value, err = parser.parseValue()
+	case "is":
+		parser.next()
+		result.kind = parser.next()
+		if result.kind != "int" && result.kind != "list" && result.kind != "empty" {
+			err = parser.errorf("int, list or empty expected")
+		}
+	}
+	return
+}
+
+func (parser *queryParser) parsePath() (result []pathStep, err error) {
+	if parser.peek() == "." {
+		parser.next()
+		return
+	}
+	for {
+		var step pathStep
+		if step, err = parser.parseStep(); err != nil {
+			return
+		}
+		result = append(result, step)
+		if parser.peek() != "/" {
+			return
+		}
+		parser.next()
+	}
+}
+
+func (parser *queryParser) parseStep() (step pathStep, err error) {
+	switch token := parser.peek(); token {
+	case "*":
+		parser.next()
+		step.kind = stepChildren
+	case "**":
+		parser.next()
+		step.kind = stepDescendants
+	case "@":
+		parser.next()
+		step.kind = stepDepth
+		if step.value, err = parser.parseInt(); err == nil && step.value < 0 {
+			err = parser.errorf("depth must not be negative")
+		}
+	default:
+		step.kind = stepIndex
+		step.value, err = parser.parseInt()
+	}
+	return
+}
+
+func (parser *queryParser) parseInt() (int, error) {
+	token := parser.peek()
+	value, err := strconv.Atoi(token)
+	if err != nil {
+		return 0, parser.errorf("number expected, got %q", token)
+	}
+	parser.next()
+	return value, nil
+}
+
+// parseValue reads a packet literal: an integer or a list.
+func (parser *queryParser) parseValue() (PacketData, error) {
+	parser.peek()
+	start := parser.pos
+	end := start
+	if end < len(parser.src) && parser.src[end] == '[' {
+		level := 0
+		for ; end < len(parser.src); end++ {
+			if parser.src[end] == '[' {
+				level++
+			} else if parser.src[end] == ']' {
+				level--
+				if level == 0 {
+					end++
+					break
+				}
+			}
+		}
+	} else {
+		if end < len(parser.src) && parser.src[end] == '-' {
+			end++
+		}
+		for end < len(parser.src) && parser.src[end] >= '0' && parser.src[end] <= '9' {
+			end++
+		}
+	}
+
+	value, err := UnmarshalPacket([]byte(parser.src[start:end]))
+	if err != nil {
+		return nil, parser.errorf("invalid packet: %v", err)
+	}
+	parser.pos = end
+	return value, nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func AssertQuery(t *testing.T, query, packet string, expected bool) {
+	q, err := ParseQuery(query)
+	if err != nil {
+		t.Fatalf("AssertQuery(t, %q, %q, %v): err %v", query, packet, expected, err)
+	}
+	p, err := UnmarshalPacket([]byte(packet))
+	if err != nil {
+		t.Fatalf("AssertQuery(t, %q, %q, %v): err %v", query, packet, expected, err)
+	}
+	if got := q.Match(p); got != expected {
+		t.Fatalf("AssertQuery(t, %q, %q, %v): got %v", query, packet, expected, got)
+	}
+}
+
+func AssertQueryErr(t *testing.T, query, expected string) {
+	_, err := ParseQuery(query)
+	if err == nil || !strings.Contains(err.Error(), expected) {
+		t.Fatalf("AssertQueryErr(t, %q, %q): got %v", query, expected, err)
+	}
+}
+
+func TestQuery(t *testing.T) {
+	AssertQuery(t, "@3 == 7", "[1,[2,[7]]]", true)
+	AssertQuery(t, "@3 == 7", "[1,[2,7]]", false)
+	AssertQuery(t, "0 is empty", "[[],1]", true)
+	AssertQuery(t, "0 is empty", "[1,[]]", false)
+	AssertQuery(t, "-1 is empty", "[1,[]]", true)
+	AssertQuery(t, "depth(.) == 3", "[1,[2,[7]]]", true)
+	AssertQuery(t, "len(.) >= 3", "[1,2]", false)
+	AssertQuery(t, "*/0 == 2", "[1,[2,[7]]]", true)
+	AssertQuery(t, "not ** == 5 and (0 == 1 or 0 == 2)", "[1,[2,[7]]]", true)
+	AssertQuery(t, "1/1", "[1,[2,[7]]]", true)
+	AssertQuery(t, "1/2", "[1,[2,[7]]]", false)
+	AssertQuery(t, ". == [1,[2]]", "[1,[2]]", true)
+	AssertQuery(t, "0 < -1", "[-2]", true)
+}
+
+func TestQueryErrors(t *testing.T) {
+	AssertQueryErr(t, "@x", "column 2: number expected")
+	AssertQueryErr(t, "0 is number", "int, list or empty expected")
+	AssertQueryErr(t, "len(0", "\")\" expected")
+	AssertQueryErr(t, "0 == [1,", "invalid packet")
+	AssertQueryErr(t, "0 0", "unexpected \"0\"")
+}
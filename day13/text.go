@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+func (d PacketIntData) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d PacketListData) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d *PacketIntData) UnmarshalText(text []byte) error {
+	packet, err := UnmarshalPacket(text)
+	if err != nil {
+		return err
+	}
+	if !packet.IsInt() {
+		return fmt.Errorf("integer expected, got %v", packet)
+	}
+	*d = packet.AsInt()
+	return nil
+}
+
+func (d *PacketListData) UnmarshalText(text []byte) error {
+	packet, err := UnmarshalPacket(text)
+	if err != nil {
+		return err
+	}
+	if !packet.IsList() {
+		return fmt.Errorf("list expected, got %v", packet)
+	}
+	*d = packet.AsList()
+	return nil
+}
+
+// UnmarshalPacket parses a single integer or list in the compact form
+// produced by MarshalText or FormatPretty. Whitespace and line breaks between
+// tokens are allowed.
+func UnmarshalPacket(text []byte) (PacketData, error) {
+	reader := NewPacketReader(bytes.NewReader(text))
+	reader.multiline = true
+	packet, err := reader.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	reader.skipSpaces()
+	if c, ok := reader.peek(); ok {
+		return nil, reader.errorf("end of input expected, got %s", describe(c, ok))
+	}
+	return packet, nil
+}
+
+// FormatPretty prints a packet in the compact form if it fits into the given
+// width and otherwise puts every item of a list on its own indented line.
+func FormatPretty(packet PacketData, width int) string {
+	var sb strings.Builder
+	writePretty(&sb, packet, "", width)
+	return sb.String()
+}
+
+func writePretty(sb *strings.Builder, packet PacketData, indent string, width int) {
+	compact := packet.String()
+	if packet.IsInt() || len(packet.AsList()) == 0 || len(indent)+len(compact) <= width {
+		sb.WriteString(compact)
+		return
+	}
+
+	sb.WriteString("[\n")
+	for i, item := range packet.AsList() {
+		sb.WriteString(indent + "  ")
+		writePretty(sb, item, indent+"  ", width)
+		if i+1 < len(packet.AsList()) {
+			sb.WriteByte(',')
+		}
+		sb.WriteByte('\n')
+	}
+	sb.WriteString(indent + "]")
+}
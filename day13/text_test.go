@@ -0,0 +1,41 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func AssertRoundTrip(t *testing.T, packet PacketData, width int) {
+	text, _ := packet.MarshalText()
+	var list PacketListData
+	if err := list.UnmarshalText(text); err != nil || Compare(list, packet) != 0 || list.String() != string(text) {
+		t.Fatalf("AssertRoundTrip(t, %v, %d): got %v, err %v", packet, width, list, err)
+	}
+
+	pretty, err := UnmarshalPacket([]byte(FormatPretty(packet, width)))
+	if err != nil || pretty.String() != packet.String() {
+		t.Fatalf("AssertRoundTrip(t, %v, %d): pretty form gives %v, err %v", packet, width, pretty, err)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	f, err := os.Open("test_input")
+	if err != nil {
+		t.Fatalf("TestRoundTrip: %v", err)
+	}
+	defer f.Close()
+
+	for _, packet := range ReadAllPackets(NewPacketReader(f)) {
+		for _, width := range []int{0, 8, 80} {
+			AssertRoundTrip(t, packet, width)
+		}
+	}
+
+	var n PacketIntData
+	if err := n.UnmarshalText([]byte("123456789012345678901234567890")); err != nil || n.String() != "123456789012345678901234567890" {
+		t.Fatalf("TestRoundTrip: big integer gives %v, err %v", n, err)
+	}
+	if err := n.UnmarshalText([]byte("[1]")); err == nil {
+		t.Fatalf("TestRoundTrip: list accepted as integer")
+	}
+}
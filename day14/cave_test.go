@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func ParseTestCave(t *testing.T, src string, sources []Pos) Cave {
+	return ParseCave(bufio.NewScanner(strings.NewReader(src)), sources)
+}
+
+func Simulate(cave *Cave, floor bool) int {
+	if floor {
+		_, max := cave.Bounds()
+		for _, source := range cave.SandSources() {
+			max.Y = Max(max.Y, source.Y)
+		}
+		cave.SetFloor(max.Y + 2)
+	}
+	for cave.AddSand() {
+	}
+	return cave.SandCount()
+}
+
+func TestNegativeCoordinates(t *testing.T) {
+	shifted := ""
+	for _, line := range strings.Split("498,4 -> 498,6 -> 496,6\n503,4 -> 502,4 -> 502,9 -> 494,9", "\n") {
+		points := []string{}
+		for _, pos := range ParsePath(line) {
+			points = append(points, fmt.Sprintf("%d,%d", pos.X-1000, pos.Y-20))
+		}
+		shifted += strings.Join(points, " -> ") + "\n"
+	}
+	source := []Pos{{-500, -20}}
+
+	cave := ParseTestCave(t, shifted, source)
+	if min, max := cave.Bounds(); min != (Pos{-506, -16}) || max != (Pos{-497, -11}) {
+		t.Fatalf("TestNegativeCoordinates: bounds %v-%v", min, max)
+	}
+	if count := Simulate(&cave, false); count != 24 {
+		t.Fatalf("TestNegativeCoordinates: %d grains without a floor, expected 24", count)
+	}
+	cave = ParseTestCave(t, shifted, source)
+	if count := Simulate(&cave, true); count != 93 {
+		t.Fatalf("TestNegativeCoordinates: %d grains with a floor, expected 93", count)
+	}
+}
+
+func TestSeveralSources(t *testing.T) {
+	src := "+ 0,0\n+ 6,3\n-2,4 -> 3,4\n5,7 -> 9,7 -> 9,5\n"
+	cave := ParseTestCave(t, src, nil)
+	if sources := cave.SandSources(); len(sources) != 2 || sources[1] != (Pos{6, 3}) {
+		t.Fatalf("TestSeveralSources: sources %v", sources)
+	}
+
+	cave = ParseTestCave(t, src, []Pos{{-4, 1}})
+	if sources := cave.SandSources(); len(sources) != 3 || sources[0] != (Pos{-4, 1}) {
+		t.Fatalf("TestSeveralSources: sources %v", sources)
+	}
+	_, max := cave.Bounds()
+	cave.SetFloor(max.Y + 2)
+	expected := cave.FloorSandCount()
+	if count := Simulate(&cave, false); count != expected {
+		t.Fatalf("TestSeveralSources: simulated %d grains, FloorSandCount %d", count, expected)
+	}
+	if single := ParseTestCave(t, src, []Pos{{0, 0}}); Simulate(&single, true) >= expected {
+		t.Fatalf("TestSeveralSources: extra sources add no sand")
+	}
+}
+
+// TestString checks that only the box around the rock, the sand and the
+// source is rendered, not the columns from x = 0.
+func TestString(t *testing.T) {
+	cave := ParseTestCave(t, "10,5 -> 12,5\n", []Pos{{11, 3}})
+	expected := ".+.\n...\n###\n"
+	if got := cave.String(); got != expected {
+		t.Fatalf("TestString: expected\n%sgot\n%s", expected, got)
+	}
+
+	Simulate(&cave, false)
+	expected = ".+.\n.o.\n###\n"
+	if got := cave.String(); got != expected {
+		t.Fatalf("TestString: expected\n%sgot\n%s", expected, got)
+	}
+}
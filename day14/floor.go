@@ -0,0 +1,34 @@
+package main
+
+// FloorSandCount counts the grains that come to rest with a floor without
+// simulating them. With a floor every grain settles, and the sand ends up
+// filling exactly the cells reachable from a source by moving one row down
+// and at most one column sideways without passing through rock: a cell is
+// filled once the cells below it are, and the cells below a filled cell are
+// reachable from it. With several sources the sand fills the union of the
+// cells reachable from each.
+func (cave *Cave) FloorSandCount() int {
+	if !cave.floor {
+		panic("Cave has no floor")
+	}
+
+	visited := map[Pos]bool{}
+	queue := []Pos{}
+	for _, source := range cave.SandSources() {
+		if !visited[source] && source.Y < cave.floorY && cave.At(source) != CellRock {
+			visited[source] = true
+			queue = append(queue, source)
+		}
+	}
+	for head := 0; head < len(queue); head++ {
+		for _, d := range [...]Pos{Pos{-1, 1}, Pos{0, 1}, Pos{1, 1}} {
+			next := queue[head].Delta(d)
+			if next.Y >= cave.floorY || visited[next] || cave.At(next) == CellRock {
+				continue
+			}
+			visited[next] = true
+			queue = append(queue, next)
+		}
+	}
+	return len(queue)
+}
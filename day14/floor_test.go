@@ -0,0 +1,35 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"testing"
+)
+
+func LoadTestCave(t *testing.T) Cave {
+	f, err := os.Open("test_input")
+	if err != nil {
+		t.Fatalf("LoadTestCave: %v", err)
+	}
+	defer f.Close()
+	return ParseCave(bufio.NewScanner(f), nil)
+}
+
+func TestFloorSandCount(t *testing.T) {
+	cave := LoadTestCave(t)
+	for cave.AddSand() {
+	}
+	if cave.SandCount() != 24 {
+		t.Fatalf("SandCount() = %d without a floor, expected 24", cave.SandCount())
+	}
+
+	cave = LoadTestCave(t)
+	_, max := cave.Bounds()
+	cave.SetFloor(max.Y + 2)
+	expected := cave.FloorSandCount()
+	for cave.AddSand() {
+	}
+	if cave.SandCount() != 93 || expected != 93 {
+		t.Fatalf("SandCount() = %d, FloorSandCount() = %d, expected 93", cave.SandCount(), expected)
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bufio"
+	"flag"
 	"fmt"
 	"os"
 	"strconv"
@@ -14,18 +15,33 @@ const (
 	CellEmpty Cell = iota
 	CellRock
 	CellSand
+	CellWater
+	CellFlowing
 )
 
 type Pos struct {
 	X, Y int
 }
 
+type SandSource struct {
+	Pos Pos
+	// path is the fall of the previous grain from this source, from the
+	// source to the cell before the one it came to rest in. path[k] is k rows
+	// below the source.
+	path []Pos
+}
+
+// Cave stores the cells of the bounding box of everything set so far, with
+// cells[x-min.X][y-min.Y] holding the cell at (x, y). Cells outside the box
+// are empty.
 type Cave struct {
 	cells      [][]Cell
-	sizeY      int
-	sandSource Pos
+	min, max   Pos
+	sources    []SandSource
+	nextSource int
 	sandCount  int
 	floor      bool
+	floorY     int
 }
 
 func (cell Cell) String() string {
@@ -36,6 +52,10 @@ func (cell Cell) String() string {
 		return "#"
 	case CellSand:
 		return "o"
+	case CellWater:
+		return "~"
+	case CellFlowing:
+		return "|"
 	}
 	panic("Invalid cell")
 }
@@ -52,90 +72,165 @@ func MakeCave() (result Cave) {
 	return
 }
 
-func (cave *Cave) SetSandSource(pos Pos) {
-	cave.sandSource = pos
+func (cave *Cave) AddSandSource(pos Pos) {
+	cave.sources = append(cave.sources, SandSource{Pos: pos})
+}
+
+func (cave *Cave) SandSources() (result []Pos) {
+	for _, source := range cave.sources {
+		result = append(result, source.Pos)
+	}
+	return
 }
 
 func (cave *Cave) SetFloor(y int) {
-	cave.floor = true
-	if y < cave.SizeY() {
+	if !cave.Empty() && y <= cave.max.Y {
 		panic("Floor not low enough")
 	}
-	cave.ResizeY(y)
+	cave.floor = true
+	cave.floorY = y
 }
 
-func (cave *Cave) SizeX() int {
-	return len(cave.cells)
+func (cave *Cave) Empty() bool {
+	return len(cave.cells) == 0
 }
 
-func (cave *Cave) SizeY() int {
-	return cave.sizeY
+// Bounds returns the corners of the bounding box of all cells set so far.
+func (cave *Cave) Bounds() (min, max Pos) {
+	return cave.min, cave.max
 }
 
 func (cave *Cave) SandCount() int {
 	return cave.sandCount
 }
 
-func (cave *Cave) ResizeX(newSize int) {
-	for i := len(cave.cells); i < newSize; i++ {
-		newRow := make([]Cell, cave.SizeY())
-		cave.cells = append(cave.cells, newRow)
+// grow extends the bounding box to include point.
+func (cave *Cave) grow(point Pos) {
+	if cave.Empty() {
+		cave.min, cave.max = point, point
+		cave.cells = [][]Cell{make([]Cell, 1)}
+		return
+	}
+
+	if point.Y < cave.min.Y || point.Y > cave.max.Y {
+		newMin, newMax := cave.min.Y, cave.max.Y
+		if point.Y < newMin {
+			newMin = point.Y
+		} else {
+			newMax = point.Y
+		}
+		for i, column := range cave.cells {
+			newColumn := make([]Cell, newMax-newMin+1)
+			copy(newColumn[cave.min.Y-newMin:], column)
+			cave.cells[i] = newColumn
+		}
+		cave.min.Y, cave.max.Y = newMin, newMax
+	}
+
+	sizeY := cave.max.Y - cave.min.Y + 1
+	for ; point.X > cave.max.X; cave.max.X++ {
+		cave.cells = append(cave.cells, make([]Cell, sizeY))
+	}
+	if point.X < cave.min.X {
+		columns := make([][]Cell, cave.min.X-point.X, cave.max.X-point.X+1)
+		for i := range columns {
+			columns[i] = make([]Cell, sizeY)
+		}
+		cave.cells = append(columns, cave.cells...)
+		cave.min.X = point.X
 	}
 }
 
-func (cave *Cave) ResizeY(newSize int) {
-	for i := 0; i < len(cave.cells); i++ {
-		newRow := make([]Cell, newSize)
-		copy(newRow, cave.cells[i])
-		cave.cells[i] = newRow
+func (cave *Cave) inBox(point Pos) bool {
+	if cave.Empty() {
+		return false
+	}
+	if point.X < cave.min.X || point.X > cave.max.X {
+		return false
+	}
+	if point.Y < cave.min.Y || point.Y > cave.max.Y {
+		return false
 	}
-	cave.sizeY = newSize
+	return true
 }
 
 func (cave *Cave) Set(point Pos, cell Cell) {
-	if point.Y >= cave.SizeY() {
-		cave.ResizeY(point.Y + 1)
-	}
-	if point.X >= cave.SizeX() {
-		cave.ResizeX(point.X + 1)
+	if !cave.inBox(point) {
+		cave.grow(point)
 	}
-	if cell == CellSand && cave.cells[point.X][point.Y] != CellSand {
+	column := cave.cells[point.X-cave.min.X]
+	if cell == CellSand && column[point.Y-cave.min.Y] != CellSand {
 		cave.sandCount++
 	}
-	cave.cells[point.X][point.Y] = cell
+	column[point.Y-cave.min.Y] = cell
 }
 
 func (cave *Cave) At(point Pos) Cell {
-	return cave.cells[point.X][point.Y]
+	if !cave.inBox(point) {
+		return CellEmpty
+	}
+	return cave.cells[point.X-cave.min.X][point.Y-cave.min.Y]
 }
 
 func (cave *Cave) IsFloor(point Pos) bool {
 	if !cave.floor {
 		return false
 	}
-	return point.Y == cave.SizeY()
+	return point.Y == cave.floorY
 }
 
-func (cave *Cave) InBounds(point Pos) bool {
-	if point.X < 0 || point.X >= cave.SizeX() {
-		return false
-	}
-	if point.Y < 0 || point.Y >= cave.SizeY() {
-		return false
-	}
-	return true
+// IsAbyss reports whether a grain at point falls forever.
+func (cave *Cave) IsAbyss(point Pos) bool {
+	return !cave.floor && (cave.Empty() || point.Y > cave.max.Y)
 }
 
+// String renders the bounding box of the occupied cells and the sources,
+// which are shown as '+' unless sand covers them.
 func (cave *Cave) String() (result string) {
-	for y := 0; y < cave.SizeY(); y++ {
-		for x := 0; x < cave.SizeX(); x++ {
-			result += cave.At(Pos{x, y}).String()
+	min, max := cave.min, cave.max
+	for i, source := range cave.sources {
+		if i == 0 && cave.Empty() {
+			min, max = source.Pos, source.Pos
+		}
+		min.X, max.X = Min(min.X, source.Pos.X), Max(max.X, source.Pos.X)
+		min.Y, max.Y = Min(min.Y, source.Pos.Y), Max(max.Y, source.Pos.Y)
+	}
+	if cave.Empty() && len(cave.sources) == 0 {
+		return
+	}
+
+	sources := map[Pos]bool{}
+	for _, source := range cave.sources {
+		sources[source.Pos] = true
+	}
+	for y := min.Y; y <= max.Y; y++ {
+		for x := min.X; x <= max.X; x++ {
+			pos := Pos{x, y}
+			if sources[pos] && cave.At(pos) == CellEmpty {
+				result += "+"
+			} else {
+				result += cave.At(pos).String()
+			}
 		}
 		result += "\n"
 	}
 	return
 }
 
+func Min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func Max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
 func (cave *Cave) AddStraightLine(a, b1, b2 int, x bool) {
 	if b2 < b1 {
 		b1, b2 = b2, b1
@@ -167,39 +262,70 @@ func (cave *Cave) AddLine(line []Pos) {
 	}
 }
 
+// AddSand drops grains from the sources in turn until one comes to rest, and
+// reports whether one did. It returns false once no source can add any more
+// sand: each is either covered or pours into the abyss.
 func (cave *Cave) AddSand() bool {
-	sand := cave.sandSource
+	for range cave.sources {
+		i := cave.nextSource
+		cave.nextSource = (i + 1) % len(cave.sources)
+		if cave.dropFrom(i) {
+			return true
+		}
+	}
+	return false
+}
 
-outer:
-	for {
-		prev := sand
-		if cave.At(prev) == CellSand {
+// dropFrom drops a grain from the i-th source. Every cell on the path of the
+// previous grain from the source is still empty, and a grain falling from
+// the source follows that path until its last cell, so the new grain starts
+// there instead of at the source.
+func (cave *Cave) dropFrom(i int) bool {
+	source := &cave.sources[i]
+	if len(source.path) == 0 {
+		if cave.At(source.Pos) != CellEmpty {
 			return false
-		} else if cave.At(prev) != CellEmpty {
-			panic("Cell expected to be empty")
 		}
+		source.path = append(source.path, source.Pos)
+	}
 
+outer:
+	for {
+		prev := source.path[len(source.path)-1]
 		for _, d := range [...]Pos{Pos{0, 1}, Pos{-1, 1}, Pos{1, 1}} {
-			sand = prev.Delta(d)
-			if sand.X >= cave.SizeX() {
-				cave.ResizeX(sand.X + 1)
-			}
+			sand := prev.Delta(d)
 			if cave.IsFloor(sand) {
 				continue
 			}
-			if !cave.InBounds(sand) {
+			if cave.IsAbyss(sand) {
 				return false
 			}
 			if cave.At(sand) == CellEmpty {
+				source.path = append(source.path, sand)
 				continue outer
 			}
 		}
 
 		cave.Set(prev, CellSand)
+		source.path = source.path[:len(source.path)-1]
+		cave.cutPaths(prev)
 		return true
 	}
 }
 
+// cutPaths truncates the paths of the sources that pass through a cell that
+// has just been filled. A grain from such a source follows its path up to
+// the filled cell and is deflected there.
+func (cave *Cave) cutPaths(filled Pos) {
+	for i := range cave.sources {
+		source := &cave.sources[i]
+		k := filled.Y - source.Pos.Y
+		if k >= 0 && k < len(source.path) && source.path[k] == filled {
+			source.path = source.path[:k]
+		}
+	}
+}
+
 func ParseInt(str string) (result int) {
 	result, err := strconv.Atoi(str)
 	if err != nil {
@@ -213,8 +339,8 @@ func ParsePoint(str string) (result Pos) {
 	if len(coords) != 2 {
 		panic("Point must have exactly 2 coordinates")
 	}
-	result.X = ParseInt(coords[0])
-	result.Y = ParseInt(coords[1])
+	result.X = ParseInt(strings.TrimSpace(coords[0]))
+	result.Y = ParseInt(strings.TrimSpace(coords[1]))
 	return
 }
 
@@ -227,26 +353,100 @@ func ParsePath(str string) (result []Pos) {
 	return
 }
 
-func main() {
-	mode2 := false
-	if (len(os.Args) > 1) && (os.Args[1] == "2") {
-		mode2 = true
+// ParseCave reads rock paths and source markers, lines of the form "+ x,y".
+// The sources given come first; without any, the source is at 500,0.
+func ParseCave(scanner *bufio.Scanner, sources []Pos) (cave Cave) {
+	cave = MakeCave()
+	for _, source := range sources {
+		cave.AddSandSource(source)
 	}
-
-	scanner := bufio.NewScanner(os.Stdin)
-	cave := MakeCave()
-	cave.SetSandSource(Pos{500, 0})
-
 	for scanner.Scan() {
 		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "+") {
+			cave.AddSandSource(ParsePoint(strings.TrimSpace(line[1:])))
+			continue
+		}
 		cave.AddLine(ParsePath(line))
 	}
+	if len(cave.sources) == 0 {
+		cave.AddSandSource(Pos{500, 0})
+	}
+	return
+}
+
+type posListFlag []Pos
+
+func (f *posListFlag) String() string {
+	items := []string{}
+	for _, pos := range *f {
+		items = append(items, fmt.Sprintf("%d,%d", pos.X, pos.Y))
+	}
+	return strings.Join(items, " ")
+}
+
+func (f *posListFlag) Set(value string) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("invalid point %q: %v", value, r)
+		}
+	}()
+	*f = append(*f, ParsePoint(value))
+	return
+}
+
+func main() {
+	var sources posListFlag
+	flag.Var(&sources, "source", "sand source x,y, may be repeated (default 500,0 unless the input marks sources with '+ x,y')")
+	show := flag.Bool("print", false, "print the cave after the simulation")
+	flag.Parse()
+
+	if flag.Arg(0) == "water" {
+		cave := ParseCave(bufio.NewScanner(os.Stdin), sources)
+		settled, flowing := cave.PourWater()
+		if *show {
+			fmt.Print(cave.String())
+		}
+		fmt.Println(settled + flowing)
+		fmt.Println("settled:", settled)
+		fmt.Println("flowing:", flowing)
+		return
+	}
+
+	mode2 := flag.Arg(0) == "2"
+	check := flag.Arg(1) == "check"
+
+	cave := ParseCave(bufio.NewScanner(os.Stdin), sources)
 
 	if mode2 {
-		cave.SetFloor(cave.SizeY() + 1)
+		_, max := cave.Bounds()
+		for _, source := range cave.SandSources() {
+			max.Y = Max(max.Y, source.Y)
+		}
+		cave.SetFloor(max.Y + 2)
+	}
+
+	expected := 0
+	if check {
+		if !mode2 {
+			panic("The closed-form count needs a floor")
+		}
+		expected = cave.FloorSandCount()
 	}
 
 	for cave.AddSand() {
 	}
+	if *show {
+		fmt.Print(cave.String())
+	}
 	fmt.Println(cave.SandCount())
+
+	if check {
+		fmt.Println("closed form:", expected)
+		if expected != cave.SandCount() {
+			panic("Simulation does not match the closed-form count")
+		}
+	}
 }
@@ -0,0 +1,81 @@
+package main
+
+// PourWater lets water run from every source until nothing changes. Water
+// falls until something holds it, then spreads sideways; a row held by walls
+// on both sides settles and the water rises, otherwise it keeps flowing and
+// falls over the edges. It returns the number of settled and flowing cells
+// between the highest and the lowest rock, as cells above the rock only
+// depend on where the sources are and the cells below it are endless.
+func (cave *Cave) PourWater() (settled, flowing int) {
+	if cave.Empty() {
+		return
+	}
+	min, max := cave.Bounds()
+	for _, source := range cave.SandSources() {
+		cave.pour(source, max.Y)
+	}
+
+	for _, column := range cave.cells {
+		for y := min.Y; y <= max.Y; y++ {
+			switch column[y-cave.min.Y] {
+			case CellWater:
+				settled++
+			case CellFlowing:
+				flowing++
+			}
+		}
+	}
+	return
+}
+
+// holdsWater reports whether water can rest on top of the cell at pos.
+func (cave *Cave) holdsWater(pos Pos) bool {
+	cell := cave.At(pos)
+	return cell == CellRock || cell == CellWater
+}
+
+// pour lets water flow into an empty cell. Once it returns, everything below
+// the cell has come to its final state, so the caller can tell from the cell
+// whether it holds water.
+func (cave *Cave) pour(pos Pos, maxY int) {
+	if pos.Y > maxY || cave.At(pos) != CellEmpty {
+		return
+	}
+	cave.Set(pos, CellFlowing)
+
+	below := pos.Delta(Pos{0, 1})
+	cave.pour(below, maxY)
+	if !cave.holdsWater(below) {
+		return
+	}
+
+	left, leftWall := cave.spread(pos, -1, maxY)
+	right, rightWall := cave.spread(pos, 1, maxY)
+	if leftWall && rightWall {
+		for x := left; x <= right; x++ {
+			cave.Set(Pos{x, pos.Y}, CellWater)
+		}
+	}
+}
+
+// spread lets water flow sideways from pos in the direction dx. It returns
+// the last column reached and whether a wall stopped the water there, rather
+// than the water falling over an edge.
+func (cave *Cave) spread(pos Pos, dx, maxY int) (int, bool) {
+	for {
+		next := pos.Delta(Pos{dx, 0})
+		if cave.holdsWater(next) {
+			return pos.X, true
+		}
+		if cave.At(next) == CellEmpty {
+			cave.Set(next, CellFlowing)
+		}
+		pos = next
+
+		below := pos.Delta(Pos{0, 1})
+		cave.pour(below, maxY)
+		if !cave.holdsWater(below) {
+			return pos.X, false
+		}
+	}
+}
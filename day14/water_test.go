@@ -0,0 +1,19 @@
+package main
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+func TestPourWater(t *testing.T) {
+	scan := `495,2 -> 495,7 -> 501,7 -> 501,3
+498,2 -> 498,4
+506,1 -> 506,2
+498,10 -> 498,13 -> 504,13 -> 504,10`
+	cave := ParseCave(bufio.NewScanner(strings.NewReader(scan)), nil)
+	settled, flowing := cave.PourWater()
+	if settled != 29 || flowing != 28 {
+		t.Fatalf("PourWater() = %d, %d, expected 29, 28\n%v", settled, flowing, cave.String())
+	}
+}